@@ -0,0 +1,406 @@
+package config
+
+import (
+	"caloricsAPI/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DatasetPath returns the location of the food dataset CSV.
+// It can be overridden with the DATASET_PATH environment variable.
+func DatasetPath() string {
+	if path := os.Getenv("DATASET_PATH"); path != "" {
+		return path
+	}
+	return "../dataset.csv"
+}
+
+// CatalogSyncSummary describes what a catalog sync changed
+type CatalogSyncSummary struct {
+	Added     []string
+	Updated   []string
+	Retired   []string
+	Restored  []string
+	Unchanged int
+	Tagged    int
+}
+
+// Print logs the diff summary of the sync
+func (s *CatalogSyncSummary) Print() {
+	log.Printf("Food catalog sync: %d added, %d updated, %d retired, %d restored, %d unchanged, %d tagged",
+		len(s.Added), len(s.Updated), len(s.Retired), len(s.Restored), s.Unchanged, s.Tagged)
+	for _, line := range s.Added {
+		log.Printf("  + %s", line)
+	}
+	for _, line := range s.Updated {
+		log.Printf("  ~ %s", line)
+	}
+	for _, line := range s.Retired {
+		log.Printf("  - %s", line)
+	}
+	for _, line := range s.Restored {
+		log.Printf("  ^ %s", line)
+	}
+}
+
+type datasetFood struct {
+	SourceID      int
+	Name          string
+	Calories      int
+	Protein       float64
+	Carbohydrates float64
+	Fat           float64
+}
+
+func readDataset(path string) ([]datasetFood, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	// Skip header
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	var rows []datasetFood
+	seen := make(map[int]bool)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip empty or invalid rows
+		if len(record) < 6 {
+			continue
+		}
+
+		name := strings.TrimSpace(record[0])
+		if name == "" || name == "deprecated" {
+			continue
+		}
+
+		sourceID, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			log.Printf("Skipping dataset row %q: invalid id %q", name, record[1])
+			continue
+		}
+		if seen[sourceID] {
+			log.Printf("Skipping dataset row %q: duplicate id %d", name, sourceID)
+			continue
+		}
+		seen[sourceID] = true
+
+		// Parse values (multiply by 100 since dataset is per gram)
+		calories, _ := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		fat, _ := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		carbs, _ := strconv.ParseFloat(strings.TrimSpace(record[4]), 64)
+		protein, _ := strconv.ParseFloat(strings.TrimSpace(record[5]), 64)
+
+		rows = append(rows, datasetFood{
+			SourceID:      sourceID,
+			Name:          name,
+			Calories:      int(calories * 100),
+			Protein:       protein * 100,
+			Carbohydrates: carbs * 100,
+			Fat:           fat * 100,
+		})
+	}
+
+	return rows, nil
+}
+
+// SyncFoodCatalog upserts the dataset into the foods table keyed on the
+// dataset's id column. Foods missing from the dataset are retired rather
+// than deleted so existing food entries keep their references.
+func SyncFoodCatalog(db *gorm.DB, path string) (*CatalogSyncSummary, error) {
+	rows, err := readDataset(path)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &CatalogSyncSummary{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var foods []models.Food
+		if err := tx.Find(&foods).Error; err != nil {
+			return err
+		}
+
+		bySource := make(map[int]*models.Food)
+		byName := make(map[string]*models.Food)
+		for i := range foods {
+			food := &foods[i]
+			if food.SourceID != nil {
+				bySource[*food.SourceID] = food
+			} else if _, exists := byName[food.Name]; !exists {
+				byName[food.Name] = food
+			}
+		}
+
+		inDataset := make(map[uint]bool)
+		for _, row := range rows {
+			food, ok := bySource[row.SourceID]
+			if !ok {
+				// Foods seeded before source IDs were tracked are matched by name once
+				if legacy, found := byName[row.Name]; found {
+					food = legacy
+					delete(byName, row.Name)
+					sourceID := row.SourceID
+					food.SourceID = &sourceID
+					if err := tx.Model(food).Update("source_id", sourceID).Error; err != nil {
+						return err
+					}
+					ok = true
+				}
+			}
+
+			if !ok {
+				if err := createDatasetFood(tx, row); err != nil {
+					return err
+				}
+				summary.Added = append(summary.Added, fmt.Sprintf("%s (#%d)", row.Name, row.SourceID))
+				continue
+			}
+
+			inDataset[food.ID] = true
+			// Merged foods stay retired, their entries now point at the survivor
+			if food.MergedIntoID != nil {
+				summary.Unchanged++
+				continue
+			}
+
+			changes := diffDatasetFood(food, row)
+			if len(changes) > 0 {
+				summary.Updated = append(summary.Updated, fmt.Sprintf("%s (#%d): %s", row.Name, row.SourceID, describeChanges(changes)))
+			}
+			if food.RetiredAt != nil {
+				changes["retired_at"] = nil
+				summary.Restored = append(summary.Restored, fmt.Sprintf("%s (#%d)", row.Name, row.SourceID))
+			}
+			if len(changes) == 0 {
+				summary.Unchanged++
+				continue
+			}
+			if err := tx.Model(food).Updates(changes).Error; err != nil {
+				return err
+			}
+		}
+
+		// Retire dataset foods that are no longer present
+		now := time.Now()
+		for i := range foods {
+			food := &foods[i]
+			if food.SourceID == nil || inDataset[food.ID] || food.RetiredAt != nil {
+				continue
+			}
+			if err := tx.Model(food).Update("retired_at", now).Error; err != nil {
+				return err
+			}
+			summary.Retired = append(summary.Retired, fmt.Sprintf("%s (#%d)", food.Name, *food.SourceID))
+		}
+
+		// Foods that were never tagged get tags inferred from their name
+		tagged, err := InferFoodTags(tx, foods)
+		if err != nil {
+			return err
+		}
+		summary.Tagged = tagged
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func diffDatasetFood(food *models.Food, row datasetFood) map[string]interface{} {
+	changes := make(map[string]interface{})
+	if food.Name != row.Name {
+		changes["name"] = row.Name
+	}
+	if food.Calories != row.Calories {
+		changes["calories"] = row.Calories
+	}
+	if !nearlyEqual(food.Protein, row.Protein) {
+		changes["protein"] = row.Protein
+	}
+	if !nearlyEqual(food.Carbohydrates, row.Carbohydrates) {
+		changes["carbohydrates"] = row.Carbohydrates
+	}
+	if !nearlyEqual(food.Fat, row.Fat) {
+		changes["fat"] = row.Fat
+	}
+	return changes
+}
+
+func describeChanges(changes map[string]interface{}) string {
+	var parts []string
+	for _, column := range []string{"name", "calories", "protein", "carbohydrates", "fat"} {
+		if value, ok := changes[column]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%v", column, value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// nonNil keeps empty lists stored as [] so they aren't inferred again
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func nearlyEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// InferFoodTags stores the tags inferred from the name of foods that have
+// none yet. Foods without curated data also get the inferred allergens and
+// an empty list of curated tags. Curated tags that only repeat the inferred
+// ones were stored by an earlier version that used guesses as tags and are
+// cleared.
+func InferFoodTags(tx *gorm.DB, foods []models.Food) (int, error) {
+	tagged := 0
+	for i := range foods {
+		food := &foods[i]
+		if food.InferredTags != nil {
+			continue
+		}
+		tags, allergens := models.InferDietaryInfo(food.Name)
+		food.InferredTags = nonNil(tags)
+		if food.Tags == nil {
+			food.Allergens = nonNil(allergens)
+		}
+		if food.Tags == nil || slices.Equal(food.Tags, food.InferredTags) {
+			food.Tags = []string{}
+		}
+		if err := tx.Model(food).Select("tags", "inferred_tags", "allergens").Updates(food).Error; err != nil {
+			return tagged, err
+		}
+		tagged++
+	}
+	return tagged, nil
+}
+
+func createDatasetFood(tx *gorm.DB, row datasetFood) error {
+	sourceID := row.SourceID
+
+	tags, allergens := models.InferDietaryInfo(row.Name)
+
+	// Create food entry with values per 100g
+	food := models.Food{
+		SourceID:      &sourceID,
+		Name:          row.Name,
+		Calories:      row.Calories,
+		Protein:       row.Protein,
+		Carbohydrates: row.Carbohydrates,
+		Fat:           row.Fat,
+		ServingSize:   100,
+		Category:      "General",
+		Tags:          []string{},
+		InferredTags:  nonNil(tags),
+		Allergens:     nonNil(allergens),
+	}
+
+	if err := tx.Create(&food).Error; err != nil {
+		return fmt.Errorf("creating food %s: %w", food.Name, err)
+	}
+
+	servings := defaultServings(food)
+	if err := tx.Create(&servings).Error; err != nil {
+		return fmt.Errorf("creating servings for food %s: %w", food.Name, err)
+	}
+
+	return nil
+}
+
+func defaultServings(food models.Food) []models.FoodServing {
+	name := strings.ToLower(food.Name)
+
+	// Add standard serving sizes
+	servings := []models.FoodServing{
+		{
+			FoodID:      food.ID,
+			Description: "100 grams",
+			Grams:       100,
+		},
+		{
+			FoodID:      food.ID,
+			Description: "50 grams",
+			Grams:       50,
+		},
+	}
+
+	// Add specific servings based on food type
+	switch {
+	case strings.Contains(name, "oil") ||
+		strings.Contains(name, "sauce") ||
+		strings.Contains(name, "dressing"):
+		servings = append(servings, []models.FoodServing{
+			{
+				FoodID:      food.ID,
+				Description: "1 tablespoon",
+				Grams:       15,
+			},
+			{
+				FoodID:      food.ID,
+				Description: "1 teaspoon",
+				Grams:       5,
+			},
+		}...)
+	case strings.Contains(name, "fruit") ||
+		strings.Contains(name, "apple") ||
+		strings.Contains(name, "orange") ||
+		strings.Contains(name, "banana") ||
+		strings.Contains(name, "pear") ||
+		strings.Contains(name, "peach"):
+		servings = append(servings, models.FoodServing{
+			FoodID:      food.ID,
+			Description: "1 medium piece",
+			Grams:       150,
+		})
+	case strings.Contains(name, "egg"):
+		servings = append(servings, models.FoodServing{
+			FoodID:      food.ID,
+			Description: "1 piece",
+			Grams:       50,
+		})
+	case strings.Contains(name, "bread") ||
+		strings.Contains(name, "toast"):
+		servings = append(servings, models.FoodServing{
+			FoodID:      food.ID,
+			Description: "1 slice",
+			Grams:       30,
+		})
+	case strings.Contains(name, "rice") ||
+		strings.Contains(name, "pasta") ||
+		strings.Contains(name, "noodle"):
+		servings = append(servings, models.FoodServing{
+			FoodID:      food.ID,
+			Description: "1 cup cooked",
+			Grams:       200,
+		})
+	}
+
+	return servings
+}
@@ -2,11 +2,7 @@ package config
 
 import (
 	"caloricsAPI/models"
-	"encoding/csv"
 	"log"
-	"os"
-	"strconv"
-	"strings"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -14,173 +10,146 @@ import (
 
 var DB *gorm.DB
 
-func seedFoodData(db *gorm.DB) error {
-	// Check if foods already exist
-	var count int64
-	db.Model(&models.Food{}).Count(&count)
-	if count > 0 {
-		return nil // Foods already exist, don't reseed
-	}
-
-	// Only drop and recreate food-related tables
-	err := db.Migrator().DropTable(&models.FoodServing{}, &models.Food{})
+// ConnectDatabase opens and migrates the database. The food catalog is
+// synced with the dataset when syncCatalog is set or when it is empty.
+func ConnectDatabase(syncCatalog bool) {
+	// Open database with specific options
+	database, err := gorm.Open(sqlite.Open("calorics.db"), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
 	if err != nil {
-		return err
+		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Recreate food-related tables
-	err = db.AutoMigrate(&models.Food{}, &models.FoodServing{})
-	if err != nil {
-		return err
+	if err := dedupeFavoriteFoods(database); err != nil {
+		log.Fatal("Failed to dedupe favorite foods:", err)
 	}
 
-	// Read the dataset CSV file
-	file, err := os.Open("../dataset.csv")
+	// First migrate all tables to ensure they exist
+	err = database.AutoMigrate(&models.User{}, &models.Food{}, &models.FoodServing{}, &models.FoodEntry{}, &models.FoodSet{},
+		&models.FoodSetItem{}, &models.FoodSetShare{},
+		&models.PlannedEntry{}, &models.ShoppingListCheck{},
+		&models.RecurringEntry{}, &models.WeightLog{},
+		&models.FavoriteFood{}, &models.IdempotencyKey{})
 	if err != nil {
-		return err
+		log.Fatal("Failed to migrate database:", err)
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	// Skip header
-	_, err = reader.Read()
-	if err != nil {
-		return err
+	if err := backfillEntryNutrition(database); err != nil {
+		log.Fatal("Failed to backfill food entry macros:", err)
+	}
+	if err := migrateFoodSetEntries(database); err != nil {
+		log.Fatal("Failed to migrate food set entries:", err)
+	}
+	if err := inferAllFoodTags(database); err != nil {
+		log.Fatal("Failed to infer food tags:", err)
+	}
+	if err := backfillWeightLogs(database); err != nil {
+		log.Fatal("Failed to backfill weight logs:", err)
+	}
+	if err := backfillShareEmails(database); err != nil {
+		log.Fatal("Failed to backfill share emails:", err)
 	}
 
-	// Read and process each row
-	for {
-		record, err := reader.Read()
-		if err != nil {
-			break // End of file
-		}
-
-		// Skip empty or invalid rows
-		if len(record) < 6 {
-			continue
-		}
-
-		// Parse values (multiply by 100 since dataset is per gram)
-		calories, _ := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
-		fat, _ := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
-		carbs, _ := strconv.ParseFloat(strings.TrimSpace(record[4]), 64)
-		protein, _ := strconv.ParseFloat(strings.TrimSpace(record[5]), 64)
-
-		name := strings.TrimSpace(record[0])
-		if name == "deprecated" {
-			continue
+	// Then bring the food catalog in line with the dataset
+	var count int64
+	database.Model(&models.Food{}).Count(&count)
+	if count > 0 && !syncCatalog {
+		log.Printf("Skipping food catalog sync")
+	} else if summary, err := SyncFoodCatalog(database, DatasetPath()); err != nil {
+		if count == 0 {
+			log.Fatal("Failed to seed food data:", err)
 		}
+		log.Printf("Failed to sync food catalog, keeping existing foods: %v", err)
+	} else {
+		summary.Print()
+	}
 
-		// Create food entry with values per 100g
-		food := models.Food{
-			Name:          name,
-			Calories:      int(calories * 100),
-			Protein:       protein * 100,
-			Carbohydrates: carbs * 100,
-			Fat:           fat * 100,
-			ServingSize:   100,
-			Category:      "General",
-		}
+	DB = database
+}
 
-		if err := db.Create(&food).Error; err != nil {
-			log.Printf("Error creating food %s: %v", food.Name, err)
-			continue
-		}
+// backfillEntryNutrition fills in serving grams and macros of entries
+// logged before they were stored on the entry
+func backfillEntryNutrition(db *gorm.DB) error {
+	if err := db.Exec(`UPDATE food_entries SET serving_grams = (
+		SELECT grams FROM food_servings
+		WHERE food_servings.food_id = food_entries.food_id
+			AND food_servings.description = food_entries.serving_desc
+		ORDER BY deleted_at IS NOT NULL LIMIT 1
+	) WHERE serving_grams IS NULL`).Error; err != nil {
+		return err
+	}
 
-		// Add standard serving sizes
-		servings := []models.FoodServing{
-			{
-				FoodID:      food.ID,
-				Description: "100 grams",
-				Grams:       100,
-			},
-			{
-				FoodID:      food.ID,
-				Description: "50 grams",
-				Grams:       50,
-			},
-		}
+	return db.Exec(`UPDATE food_entries SET
+		protein = COALESCE((SELECT protein FROM foods WHERE foods.id = food_entries.food_id), 0) * COALESCE(serving_grams, 0) * quantity / 100.0,
+		carbohydrates = COALESCE((SELECT carbohydrates FROM foods WHERE foods.id = food_entries.food_id), 0) * COALESCE(serving_grams, 0) * quantity / 100.0,
+		fat = COALESCE((SELECT fat FROM foods WHERE foods.id = food_entries.food_id), 0) * COALESCE(serving_grams, 0) * quantity / 100.0
+		WHERE protein IS NULL`).Error
+}
 
-		// Add specific servings based on food type
-		switch {
-		case strings.Contains(strings.ToLower(name), "oil") ||
-			strings.Contains(strings.ToLower(name), "sauce") ||
-			strings.Contains(strings.ToLower(name), "dressing"):
-			servings = append(servings, []models.FoodServing{
-				{
-					FoodID:      food.ID,
-					Description: "1 tablespoon",
-					Grams:       15,
-				},
-				{
-					FoodID:      food.ID,
-					Description: "1 teaspoon",
-					Grams:       5,
-				},
-			}...)
-		case strings.Contains(strings.ToLower(name), "fruit") ||
-			strings.Contains(strings.ToLower(name), "apple") ||
-			strings.Contains(strings.ToLower(name), "orange") ||
-			strings.Contains(strings.ToLower(name), "banana") ||
-			strings.Contains(strings.ToLower(name), "pear") ||
-			strings.Contains(strings.ToLower(name), "peach"):
-			servings = append(servings, models.FoodServing{
-				FoodID:      food.ID,
-				Description: "1 medium piece",
-				Grams:       150,
-			})
-		case strings.Contains(strings.ToLower(name), "egg"):
-			servings = append(servings, models.FoodServing{
-				FoodID:      food.ID,
-				Description: "1 piece",
-				Grams:       50,
-			})
-		case strings.Contains(strings.ToLower(name), "bread") ||
-			strings.Contains(strings.ToLower(name), "toast"):
-			servings = append(servings, models.FoodServing{
-				FoodID:      food.ID,
-				Description: "1 slice",
-				Grams:       30,
-			})
-		case strings.Contains(strings.ToLower(name), "rice") ||
-			strings.Contains(strings.ToLower(name), "pasta") ||
-			strings.Contains(strings.ToLower(name), "noodle"):
-			servings = append(servings, models.FoodServing{
-				FoodID:      food.ID,
-				Description: "1 cup cooked",
-				Grams:       200,
-			})
-		}
+// inferAllFoodTags separates the tags inferred from food names from the
+// curated ones, also when the catalog sync is skipped
+func inferAllFoodTags(db *gorm.DB) error {
+	var foods []models.Food
+	if err := db.Where("inferred_tags IS NULL").Find(&foods).Error; err != nil {
+		return err
+	}
+	_, err := InferFoodTags(db, foods)
+	return err
+}
 
-		for _, serving := range servings {
-			if err := db.Create(&serving).Error; err != nil {
-				log.Printf("Error creating serving for food %s: %v", food.Name, err)
-			}
-		}
+// dedupeFavoriteFoods purges removed favorites and keeps the oldest of
+// duplicate ones, so the unique index on user and food can be created
+func dedupeFavoriteFoods(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.FavoriteFood{}) {
+		return nil
+	}
+	if err := db.Exec("DELETE FROM favorite_foods WHERE deleted_at IS NOT NULL").Error; err != nil {
+		return err
 	}
+	return db.Exec(`DELETE FROM favorite_foods WHERE id NOT IN (
+		SELECT MIN(id) FROM favorite_foods GROUP BY user_id, food_id)`).Error
+}
 
-	return nil
+// backfillWeightLogs records the current weight of users who have none
+// logged yet, dated the last time their profile changed
+func backfillWeightLogs(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO weight_logs (created_at, updated_at, user_id, date, weight)
+		SELECT CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, id, date(updated_at), weight FROM users
+		WHERE weight > 0 AND deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM weight_logs WHERE weight_logs.user_id = users.id)`).Error
 }
 
-func ConnectDatabase() {
-	// Open database with specific options
-	database, err := gorm.Open(sqlite.Open("calorics.db"), &gorm.Config{
-		DisableForeignKeyConstraintWhenMigrating: true,
-	})
-	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
-	}
+// backfillShareEmails stores the address of users food sets were shared
+// with before shares were made by email
+func backfillShareEmails(db *gorm.DB) error {
+	return db.Exec(`UPDATE food_set_shares SET email = (
+		SELECT LOWER(email) FROM users WHERE users.id = food_set_shares.user_id
+	) WHERE email IS NULL`).Error
+}
 
-	// First migrate all tables to ensure they exist
-	err = database.AutoMigrate(&models.User{}, &models.Food{}, &models.FoodServing{}, &models.FoodEntry{}, &models.FoodSet{})
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+// migrateFoodSetEntries moves food set items that were stored as food
+// entries to their own table. Items of deleted sets are deleted with them.
+func migrateFoodSetEntries(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("food_entries", "food_set_id") {
+		return nil
 	}
 
-	// Then seed food data if needed
-	if err := seedFoodData(database); err != nil {
-		log.Fatal("Failed to seed food data:", err)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO food_set_items (created_at, updated_at, deleted_at, food_set_id, food_id,
+			serving_desc, serving_grams, quantity, calories, protein, carbohydrates, fat)
+		SELECT e.created_at, e.updated_at, COALESCE(e.deleted_at, s.deleted_at), e.food_set_id, e.food_id,
+			e.serving_desc, COALESCE(e.serving_grams, 0), e.quantity, e.calories,
+			COALESCE(e.protein, 0), COALESCE(e.carbohydrates, 0), COALESCE(e.fat, 0)
+		FROM food_entries e LEFT JOIN food_sets s ON s.id = e.food_set_id
+		WHERE e.food_set_id IS NOT NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM food_entries WHERE food_set_id IS NOT NULL").Error
+	})
+	if err != nil {
+		return err
 	}
 
-	DB = database
+	return db.Exec("ALTER TABLE food_entries DROP COLUMN food_set_id").Error
 }
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"caloricsAPI/models"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TrashRetention returns how long deleted food entries can be restored.
+// It defaults to 30 days and can be set with TRASH_RETENTION_DAYS.
+func TrashRetention() time.Duration {
+	days := 30
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			days = parsed
+		} else {
+			log.Printf("Invalid TRASH_RETENTION_DAYS %q, using %d days", value, days)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeTrash permanently removes food entries deleted longer than
+// retention ago and returns how many were removed
+func PurgeTrash(db *gorm.DB, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	result := db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(&models.FoodEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// StartTrashPurge purges the trash now and then every hour in the background
+func StartTrashPurge() {
+	retention := TrashRetention()
+	purge := func() {
+		purged, err := PurgeTrash(DB, retention)
+		if err != nil {
+			log.Printf("Failed to purge deleted food entries: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted food entries", purged)
+		}
+	}
+
+	purge()
+	go func() {
+		for range time.Tick(time.Hour) {
+			purge()
+		}
+	}()
+}
@@ -4,13 +4,21 @@ import (
 	"caloricsAPI/config"
 	"caloricsAPI/middleware"
 	"caloricsAPI/models"
+	"errors"
+	"flag"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // Add this new struct for direct food entry
@@ -22,18 +30,34 @@ type DirectFoodEntry struct {
 }
 
 func main() {
+	syncFoods := flag.Bool("sync-foods", false, "sync the food catalog with the dataset and exit")
+	flag.Parse()
+
+	if *syncFoods {
+		config.ConnectDatabase(false)
+		summary, err := config.SyncFoodCatalog(config.DB, config.DatasetPath())
+		if err != nil {
+			log.Fatal("Failed to sync food catalog:", err)
+		}
+		summary.Print()
+		return
+	}
+
 	router := gin.Default()
 
 	// Configure CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"X-Next-Cursor", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
 	// Connect to database
-	config.ConnectDatabase()
+	config.ConnectDatabase(os.Getenv("SKIP_CATALOG_SYNC") == "")
+	config.StartTrashPurge()
+	startRecurringEntries()
 
 	// Public routes
 	router.POST("/api/register", register)
@@ -42,22 +66,70 @@ func main() {
 	// Protected routes
 	protected := router.Group("/api")
 	protected.Use(middleware.AuthMiddleware())
+	// Create endpoints replay their response for retried requests
+	idempotent := middleware.IdempotencyMiddleware()
 	{
 		protected.GET("/user/stats", getUserStats)
 		protected.GET("/user/profile", getProfile)
 		protected.PUT("/user/profile", updateProfile)
 		protected.GET("/foods", getFoods)
-		protected.POST("/food-entries", createFoodEntry)
+		protected.GET("/foods/favorites", getFavoriteFoods)
+		protected.GET("/foods/recent", getRecentFoods)
+		protected.POST("/foods/:id/favorite", addFavoriteFood)
+		protected.DELETE("/foods/:id/favorite", removeFavoriteFood)
+		protected.POST("/food-entries", idempotent, createFoodEntry)
+		protected.POST("/food-entries/parse", idempotent, parseFoodEntries)
+		protected.POST("/food-entries/batch", idempotent, batchFoodEntries)
+		protected.POST("/food-entries/copy", idempotent, copyFoodEntries)
 		protected.GET("/food-entries", getUserFoodEntries)
+		protected.GET("/food-entries/trash", getTrashedFoodEntries)
+		protected.POST("/food-entries/undo", idempotent, undoDeleteFoodEntries)
+		protected.POST("/food-entries/:id/restore", idempotent, restoreFoodEntry)
+		protected.PUT("/food-entries/:id", updateFoodEntry)
 		protected.DELETE("/food-entries/:id", deleteFoodEntry)
 		protected.GET("/debug/food-entries", debugFoodEntries)
-		protected.POST("/food-sets", createFoodSet)
+		protected.POST("/food-sets", idempotent, createFoodSet)
 		protected.GET("/food-sets", getUserFoodSets)
-		//protected.GET("/food-sets/:id", getFoodSet)
-		//protected.PUT("/food-sets/:id", updateFoodSet)
+		protected.GET("/food-sets/shared", getSharedFoodSets)
+		protected.GET("/food-sets/library", getFoodSetLibrary)
+		protected.GET("/food-sets/link/:token", getLinkedFoodSet)
+		protected.GET("/food-sets/:id", getFoodSet)
+		protected.PUT("/food-sets/:id", updateFoodSet)
 		protected.DELETE("/food-sets/:id", deleteFoodSet)
-		protected.POST("/food-sets/:id/apply", applyFoodSet)
+		protected.POST("/food-sets/:id/apply", idempotent, applyFoodSet)
+		protected.POST("/food-sets/:id/items", idempotent, addFoodSetItem)
+		protected.PUT("/food-sets/:id/items/:itemId", updateFoodSetItem)
+		protected.DELETE("/food-sets/:id/items/:itemId", deleteFoodSetItem)
+		protected.POST("/food-sets/:id/share", idempotent, shareFoodSet)
+		protected.POST("/food-sets/:id/import", idempotent, importFoodSet)
 		protected.GET("/user/weekly-stats", getWeeklyStats)
+		protected.GET("/user/analytics", getAnalytics)
+		protected.GET("/user/streaks", getStreaks)
+		protected.GET("/plan", getPlan)
+		protected.GET("/plan/stats", getPlanStats)
+		protected.POST("/plan", idempotent, createPlannedEntry)
+		protected.POST("/plan/generate", idempotent, generatePlan)
+		protected.PUT("/plan/:id", updatePlannedEntry)
+		protected.DELETE("/plan/:id", deletePlannedEntry)
+		protected.POST("/plan/:id/eat", idempotent, eatPlannedEntry)
+		protected.GET("/recurring", getRecurringEntries)
+		protected.POST("/recurring", idempotent, createRecurringEntry)
+		protected.POST("/recurring/:id/skip", skipRecurringEntry)
+		protected.POST("/recurring/:id/end", endRecurringEntry)
+		protected.DELETE("/recurring/:id", deleteRecurringEntry)
+		protected.GET("/shopping-list", getShoppingList)
+		protected.PUT("/shopping-list/check", checkShoppingItem)
+		protected.GET("/sync", pullChanges)
+		protected.POST("/sync", idempotent, pushChanges)
+	}
+
+	// Admin routes
+	admin := protected.Group("/admin")
+	admin.Use(middleware.AdminMiddleware())
+	{
+		admin.GET("/foods/duplicates", getDuplicateFoods)
+		admin.POST("/foods/merge", mergeFoods)
+		admin.PUT("/foods/:id/dietary", updateFoodDietary)
 	}
 
 	router.Run(":8080")
@@ -79,6 +151,11 @@ func register(c *gin.Context) {
 	}
 	user.Password = string(hashedPassword)
 
+	if !models.ValidTimeZone(user.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+
 	// Set default values
 	if user.Goal == "" {
 		user.Goal = "maintain"
@@ -89,6 +166,14 @@ func register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create user: " + err.Error()})
 		return
 	}
+	if err := recordWeight(config.DB, &user); err != nil {
+		log.Printf("Failed to record weight of user %d: %v", user.ID, err)
+	}
+	// Accept food sets shared with the address before it registered
+	if err := config.DB.Model(&models.FoodSetShare{}).Where("user_id = 0 AND email = ?", strings.ToLower(user.Email)).
+		Update("user_id", user.ID).Error; err != nil {
+		log.Printf("Failed to accept pending shares of user %d: %v", user.ID, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Registration successful"})
 }
@@ -141,8 +226,6 @@ func getUserStats(c *gin.Context) {
 			return
 		}
 		targetDate = queryDate
-	} else {
-		targetDate = time.Now().Format("2006-01-02")
 	}
 
 	var user models.User
@@ -153,6 +236,9 @@ func getUserStats(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if targetDate == "" {
+		targetDate = user.Today()
+	}
 
 	// Filter entries for target date
 	var dateEntries []models.FoodEntry
@@ -177,6 +263,10 @@ func getUserStats(c *gin.Context) {
 	// Get needed calories
 	neededCalories := user.CalculateNeededCalories()
 
+	// Sum up macros and compare them with the targets
+	totals := models.SumNutrition(dateEntries)
+	targets := user.CalculateMacroTargets()
+
 	// Create stats response
 	stats := models.UserStats{
 		DailyCalories:    dailyCalories,
@@ -188,6 +278,10 @@ func getUserStats(c *gin.Context) {
 		Goal:             user.Goal,
 		Age:              age,
 		FoodEntries:      dateEntries,
+		Meals:            models.MealTotalsFor(dateEntries, user.Meals()),
+		Totals:           totals,
+		Targets:          targets,
+		Remaining:        targets.Minus(totals),
 	}
 
 	log.Printf("Returning stats with %d food entries for date %s", len(stats.FoodEntries), targetDate)
@@ -203,25 +297,7 @@ func getProfile(c *gin.Context) {
 		return
 	}
 
-	// Calculate age and fat percentage before sending response
-	user.CalculateAge()
-	user.CalculateFatPercentage()
-
-	// Create a response without sensitive information
-	profile := gin.H{
-		"name":          user.Name,
-		"email":         user.Email,
-		"gender":        user.Gender,
-		"birthday":      user.Birthday,
-		"age":           user.Age,
-		"weight":        user.Weight,
-		"height":        user.Height,
-		"neckMeasure":   user.NeckMeasure,
-		"waistMeasure":  user.WaistMeasure,
-		"hipMeasure":    user.HipMeasure,
-		"fatPercentage": user.FatPercentage,
-		"goal":          user.Goal,
-	}
+	profile := profileResponse(&user)
 
 	// Log the profile for debugging
 	log.Printf("User profile: %+v", profile)
@@ -229,6 +305,33 @@ func getProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, profile)
 }
 
+// profileResponse returns the user's profile without sensitive information
+func profileResponse(user *models.User) gin.H {
+	// Calculate age and fat percentage before sending response
+	user.CalculateAge()
+	user.CalculateFatPercentage()
+
+	return gin.H{
+		"name":               user.Name,
+		"email":              user.Email,
+		"gender":             user.Gender,
+		"birthday":           user.Birthday,
+		"age":                user.Age,
+		"weight":             user.Weight,
+		"height":             user.Height,
+		"neckMeasure":        user.NeckMeasure,
+		"waistMeasure":       user.WaistMeasure,
+		"hipMeasure":         user.HipMeasure,
+		"fatPercentage":      user.FatPercentage,
+		"goal":               user.Goal,
+		"dietaryPreferences": user.DietaryPrefs,
+		"allergens":          user.Allergens,
+		"customMeals":        user.CustomMeals,
+		"meals":              user.Meals(),
+		"timeZone":           user.TimeZone,
+	}
+}
+
 func updateProfile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	var user models.User
@@ -239,6 +342,11 @@ func updateProfile(c *gin.Context) {
 		WaistMeasurement int    `json:"waistMeasurement"`
 		HipMeasurement   int    `json:"hipMeasurement"`
 		Goal             string `json:"goal" binding:"omitempty,oneof=lose maintain gain"`
+		// Lists are only replaced when present in the request
+		DietaryPreferences []string `json:"dietaryPreferences" binding:"omitempty,dive,oneof=vegan vegetarian gluten-free lactose-free halal kosher"`
+		Allergens          []string `json:"allergens" binding:"omitempty,dive,oneof=celery gluten crustaceans eggs fish lupin milk molluscs mustard nuts peanuts sesame soybeans sulphites"`
+		CustomMeals        []string `json:"customMeals" binding:"omitempty,dive,min=1,max=30"`
+		TimeZone           *string  `json:"timeZone"`
 	}
 
 	if err := config.DB.First(&user, userID).Error; err != nil {
@@ -252,6 +360,7 @@ func updateProfile(c *gin.Context) {
 	}
 
 	// Update user data
+	previousWeight := user.Weight
 	user.Weight = updateData.CurrentWeight
 	user.Height = updateData.Height
 	user.NeckMeasure = updateData.NeckMeasurement
@@ -260,6 +369,33 @@ func updateProfile(c *gin.Context) {
 	if updateData.Goal != "" {
 		user.Goal = updateData.Goal
 	}
+	if updateData.DietaryPreferences != nil {
+		user.DietaryPrefs = updateData.DietaryPreferences
+	}
+	if updateData.Allergens != nil {
+		user.Allergens = updateData.Allergens
+	}
+	if updateData.CustomMeals != nil {
+		customMeals := []string{}
+		for _, meal := range updateData.CustomMeals {
+			meal = models.NormalizeMeal(meal)
+			if meal == "" || meal == "unassigned" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal name"})
+				return
+			}
+			if !slices.Contains(models.DefaultMeals, meal) && !slices.Contains(customMeals, meal) {
+				customMeals = append(customMeals, meal)
+			}
+		}
+		user.CustomMeals = customMeals
+	}
+	if updateData.TimeZone != nil {
+		if !models.ValidTimeZone(*updateData.TimeZone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+			return
+		}
+		user.TimeZone = *updateData.TimeZone
+	}
 
 	// Calculate fat percentage and needed calories
 	user.CalculateFatPercentage()
@@ -269,6 +405,11 @@ func updateProfile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
+	if user.Weight != previousWeight {
+		if err := recordWeight(config.DB, &user); err != nil {
+			log.Printf("Failed to record weight of user %d: %v", user.ID, err)
+		}
+	}
 
 	// Return updated profile including fat percentage, goal, and needed calories
 	c.JSON(http.StatusOK, gin.H{
@@ -279,9 +420,46 @@ func updateProfile(c *gin.Context) {
 	})
 }
 
+// recordWeight logs the user's current weight for today, replacing an
+// earlier weight logged the same day
+func recordWeight(db *gorm.DB, user *models.User) error {
+	if user.Weight <= 0 {
+		return nil
+	}
+	weightLog := models.WeightLog{UserID: user.ID, Date: user.Today()}
+	return db.Where(&weightLog).Assign(models.WeightLog{Weight: user.Weight}).FirstOrCreate(&weightLog).Error
+}
+
 func getFoods(c *gin.Context) {
+	// Optional dietary filters, e.g. ?tags=vegan,gluten-free&exclude_allergens=nuts
+	tags := splitList(c.Query("tags"))
+	excludeAllergens := splitList(c.Query("exclude_allergens"))
+	for _, tag := range tags {
+		if !slices.Contains(models.DietaryTags, tag) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown dietary tag: " + tag})
+			return
+		}
+	}
+	for _, allergen := range excludeAllergens {
+		if !slices.Contains(models.Allergens, allergen) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown allergen: " + allergen})
+			return
+		}
+	}
+
+	// Apply the user's own preferences and allergens when asked to
+	if c.Query("use_profile") == "true" {
+		var user models.User
+		if err := config.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		tags = append(tags, user.DietaryPrefs...)
+		excludeAllergens = append(excludeAllergens, user.Allergens...)
+	}
+
 	var foods []models.Food
-	if err := config.DB.Find(&foods).Error; err != nil {
+	if err := config.DB.Where("retired_at IS NULL").Find(&foods).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
 		return
 	}
@@ -295,11 +473,25 @@ func getFoods(c *gin.Context) {
 		Fat           float64              `json:"fat"`
 		ServingSize   int                  `json:"serving_size"`
 		Category      string               `json:"category"`
+		Tags          []string             `json:"tags"`
+		InferredTags  []string             `json:"inferred_tags"`
+		Allergens     []string             `json:"allergens"`
 		Servings      []models.FoodServing `json:"servings"`
+		Favorite      bool                 `json:"favorite"`
+	}
+
+	favorites, err := favoriteFoodIDs(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorite foods"})
+		return
 	}
 
 	var response []FoodResponse
 	for _, food := range foods {
+		if !food.MatchesDiet(tags, excludeAllergens) {
+			continue
+		}
+
 		var servings []models.FoodServing
 		if err := config.DB.Where("food_id = ?", food.ID).Find(&servings).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food servings"})
@@ -315,7 +507,11 @@ func getFoods(c *gin.Context) {
 			Fat:           food.Fat,
 			ServingSize:   food.ServingSize,
 			Category:      food.Category,
+			Tags:          food.Tags,
+			InferredTags:  food.InferredTags,
+			Allergens:     food.Allergens,
 			Servings:      servings,
+			Favorite:      favorites[food.ID],
 		})
 	}
 
@@ -335,342 +531,3071 @@ func createFoodEntry(c *gin.Context) {
 	// Set the user ID
 	foodEntry.UserID = userID
 
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := prepareFoodEntry(config.DB, &user, &foodEntry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Creating food entry for user %d: Date=%s, FoodID=%d, Quantity=%f, Calories=%f",
+		userID, foodEntry.Date, foodEntry.FoodID, foodEntry.Quantity, foodEntry.Calories)
+
+	// Create the food entry
+	if err := config.DB.Create(&foodEntry).Error; err != nil {
+		log.Printf("Error creating food entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entry"})
+		return
+	}
+
+	// Load the associated food data for the response
+	if err := config.DB.Preload("Food").First(&foodEntry, foodEntry.ID).Error; err != nil {
+		log.Printf("Error loading food data for response: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load food data"})
+		return
+	}
+
+	log.Printf("Successfully created food entry: ID=%d, Date=%s, Food=%s, Calories=%f",
+		foodEntry.ID, foodEntry.Date, foodEntry.Food.Name, foodEntry.Calories)
+
+	// Warn when the food conflicts with the user's allergens or diet
+	c.JSON(http.StatusOK, struct {
+		models.FoodEntry
+		Warnings []string `json:"warnings,omitempty"`
+	}{foodEntry, user.DietaryConflicts(foodEntry.Food)})
+}
+
+// Validation errors returned by prepareFoodEntry
+var (
+	errInvalidFood    = errors.New("Invalid food ID")
+	errRetiredFood    = errors.New("Food is no longer available")
+	errInvalidServing = errors.New("Invalid serving size")
+	errInvalidDate    = errors.New("Invalid date format. Use YYYY-MM-DD")
+	errInvalidMeal    = errors.New("Unknown meal")
+	errInvalidTime    = errors.New("Invalid time format. Use HH:MM")
+)
+
+// prepareFoodEntry checks the food, serving and meal of a user's entry and
+// fills in its serving grams, calories and date. Invalid input is reported
+// with one of the validation errors above.
+func prepareFoodEntry(db *gorm.DB, user *models.User, foodEntry *models.FoodEntry) error {
+	foodEntry.Meal = models.NormalizeMeal(foodEntry.Meal)
+	if !user.HasMeal(foodEntry.Meal) {
+		return errInvalidMeal
+	}
+	if foodEntry.Time != "" && !models.ValidTimeOfDay(foodEntry.Time) {
+		return errInvalidTime
+	}
+
 	// Load the food data to calculate calories
 	var food models.Food
-	if err := config.DB.First(&food, foodEntry.FoodID).Error; err != nil {
+	if err := db.First(&food, foodEntry.FoodID).Error; err != nil {
 		log.Printf("Error loading food data: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
-		return
+		return errInvalidFood
+	}
+	// Existing entries may keep a food that has since been retired
+	if food.RetiredAt != nil && foodEntry.ID == 0 {
+		return errRetiredFood
 	}
 
 	// Find the serving size
 	var serving models.FoodServing
-	if err := config.DB.Where("food_id = ? AND description = ?", foodEntry.FoodID, foodEntry.ServingDesc).First(&serving).Error; err != nil {
+	if err := db.Where("food_id = ? AND description = ?", foodEntry.FoodID, foodEntry.ServingDesc).First(&serving).Error; err != nil {
 		log.Printf("Error loading serving data: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid serving size"})
-		return
+		return errInvalidServing
 	}
 
 	// Store the serving grams
 	foodEntry.ServingGrams = serving.Grams
 
-	// Calculate calories based on serving size and quantity
-	// (calories per 100g * serving grams * quantity) / 100
-	foodEntry.Calories = float64(food.Calories) * serving.Grams * foodEntry.Quantity / 100.0
+	// Calculate calories and macros based on serving size and quantity
+	foodEntry.SetNutrition(food)
 
 	log.Printf("Calculated calories: %f (food calories per 100g: %d, serving grams: %f, quantity: %f)",
 		foodEntry.Calories, food.Calories, serving.Grams, foodEntry.Quantity)
 
 	// Ensure the date is in the correct format (YYYY-MM-DD)
 	if foodEntry.Date == "" {
-		foodEntry.Date = time.Now().Format("2006-01-02")
+		foodEntry.Date = user.Today()
 	} else {
 		// Try to parse and reformat the date to ensure consistency
 		parsedDate, err := time.Parse("2006-01-02", foodEntry.Date)
 		if err != nil {
 			log.Printf("Invalid date format: %s", foodEntry.Date)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
-			return
+			return errInvalidDate
 		}
 		foodEntry.Date = parsedDate.Format("2006-01-02")
 	}
+	foodEntry.SetConsumedAt(user)
 
-	log.Printf("Creating food entry for user %d: Date=%s, FoodID=%d, Quantity=%f, Calories=%f",
-		userID, foodEntry.Date, foodEntry.FoodID, foodEntry.Quantity, foodEntry.Calories)
+	return nil
+}
 
-	// Create the food entry
-	if err := config.DB.Create(&foodEntry).Error; err != nil {
-		log.Printf("Error creating food entry: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entry"})
+// getUserFoodEntries lists the user's entries a page at a time. The cursor
+// of the next page is returned in the X-Next-Cursor header, which is absent
+// on the last page.
+func getUserFoodEntries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	date := c.Query("date") // Optional date filter
+	from := c.Query("from") // Optional date range, both ends included
+	to := c.Query("to")
+	meal := c.Query("meal") // Optional meal filter
+	sort := c.DefaultQuery("sort", "created_desc")
+
+	for _, value := range []string{date, from, to} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+	if from != "" && to != "" && from > to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
 		return
 	}
-
-	// Load the associated food data for the response
-	if err := config.DB.Preload("Food").First(&foodEntry, foodEntry.ID).Error; err != nil {
-		log.Printf("Error loading food data for response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load food data"})
+	if !slices.Contains(models.EntrySorts, sort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown sort, use one of: " + strings.Join(models.EntrySorts, ", ")})
 		return
 	}
 
-	log.Printf("Successfully created food entry: ID=%d, Date=%s, Food=%s, Calories=%f",
-		foodEntry.ID, foodEntry.Date, foodEntry.Food.Name, foodEntry.Calories)
-
-	c.JSON(http.StatusOK, foodEntry)
-}
-
-func getUserFoodEntries(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	date := c.Query("date") // Optional date filter
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 500"})
+			return
+		}
+		limit = parsed
+	}
 
 	query := config.DB.Preload("Food").Where("user_id = ?", userID)
 	if date != "" {
 		query = query.Where("date = ?", date)
 	}
+	if from != "" {
+		query = query.Where("date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("date <= ?", to)
+	}
+	if meal == "unassigned" {
+		query = query.Where("meal = ''")
+	} else if meal != "" {
+		query = query.Where("meal = ?", models.NormalizeMeal(meal))
+	}
+	if value := c.Query("food_id"); value != "" {
+		foodID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+			return
+		}
+		query = query.Where("food_id = ?", foodID)
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := models.DecodeEntryCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		switch sort {
+		case "created_desc":
+			query = query.Where("id < ?", cursor.ID)
+		case "created_asc":
+			query = query.Where("id > ?", cursor.ID)
+		case "date_desc":
+			query = query.Where("date < ? OR (date = ? AND id < ?)", cursor.Date, cursor.Date, cursor.ID)
+		case "date_asc":
+			query = query.Where("date > ? OR (date = ? AND id > ?)", cursor.Date, cursor.Date, cursor.ID)
+		}
+	}
+
+	// IDs follow creation order, so they also sort by creation time
+	switch sort {
+	case "created_desc":
+		query = query.Order("id desc")
+	case "created_asc":
+		query = query.Order("id asc")
+	case "date_desc":
+		query = query.Order("date desc, id desc")
+	case "date_asc":
+		query = query.Order("date asc, id asc")
+	}
 
+	// Fetch one extra entry to know whether there is a next page
 	var entries []models.FoodEntry
-	if err := query.Order("created_at desc").Find(&entries).Error; err != nil {
+	if err := query.Limit(limit + 1).Find(&entries).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food entries"})
 		return
 	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		c.Header("X-Next-Cursor", models.CursorFor(entries[limit-1]).Encode())
+	}
 
 	c.JSON(http.StatusOK, entries)
 }
 
-func deleteFoodEntry(c *gin.Context) {
+func updateFoodEntry(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	entryID := c.Param("id")
 
+	var update models.FoodEntryUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var entry models.FoodEntry
 	if err := config.DB.Where("id = ? AND user_id = ?", entryID, userID).First(&entry).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Food entry not found"})
 		return
 	}
 
-	if err := config.DB.Delete(&entry).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food entry"})
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Food entry deleted successfully"})
-}
-
-func createDirectFoodEntry(c *gin.Context) {
-	var directEntry DirectFoodEntry
-	if err := c.ShouldBindJSON(&directEntry); err != nil {
+	// Re-validate the serving and recalculate calories and macros
+	update.Apply(&entry)
+	if err := prepareFoodEntry(config.DB, &user, &entry); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	userID := c.GetUint("user_id")
-
-	// Create the food
-	food := models.Food{
-		Name:        directEntry.Name,
-		Calories:    directEntry.Calories,
-		ServingSize: 100, // Default serving size of 100g
-	}
-
-	if err := config.DB.Create(&food).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food"})
+	if err := config.DB.Omit("Food").Save(&entry).Error; err != nil {
+		log.Printf("Error updating food entry %d: %v", entry.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food entry"})
 		return
 	}
 
-	// Calculate calories based on quantity
-	caloriesForQuantity := float64(directEntry.Calories) * float64(directEntry.Quantity) / 100.0
-
-	// Create the food entry
-	foodEntry := models.FoodEntry{
-		UserID:   userID,
-		FoodID:   food.ID,
-		Food:     food,
-		Quantity: float64(directEntry.Quantity),
-		Date:     directEntry.Date,
-		Calories: caloriesForQuantity,
-	}
-
-	if err := config.DB.Create(&foodEntry).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entry"})
+	if err := config.DB.Preload("Food").First(&entry, entry.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load food data"})
 		return
 	}
 
-	c.JSON(http.StatusOK, foodEntry)
+	c.JSON(http.StatusOK, entry)
 }
 
-func debugFoodEntries(c *gin.Context) {
+// errBatchFailed rolls back a batch when one of its items is invalid
+var errBatchFailed = errors.New("batch failed")
+
+// errAlreadyEaten rolls back logging a planned item that another request
+// marked as eaten first
+var errAlreadyEaten = errors.New("Planned entry was already eaten")
+
+func batchFoodEntries(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	var entries []models.FoodEntry
 
-	if err := config.DB.Where("user_id = ?", userID).
-		Preload("Food").
-		Find(&entries).Error; err != nil {
-		log.Printf("Error fetching food entries: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food entries"})
+	var batch models.FoodEntryBatch
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	log.Printf("Found %d total food entries for user %d", len(entries), userID)
-	for i, entry := range entries {
-		log.Printf("Entry %d: Date: %s, Food ID: %d, Name: %s, Calories: %f",
-			i, entry.Date, entry.FoodID, entry.Food.Name, entry.Calories)
+	if len(batch.Create)+len(batch.Update)+len(batch.Delete) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Batch is empty"})
+		return
 	}
 
-	c.JSON(http.StatusOK, entries)
-}
-
-func createFoodSet(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	var foodSet models.FoodSet
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
 
-	if err := c.ShouldBindJSON(&foodSet); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	undoToken, err := models.NewRandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply food entry batch"})
 		return
 	}
 
-	foodSet.UserID = userID
+	results := []models.BatchItemResult{}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		failed := false
+
+		for i := range batch.Create {
+			entry := batch.Create[i]
+			entry.ID = 0
+			entry.UserID = userID
+			result := models.BatchItemResult{Operation: "create", Index: i}
+			if err := prepareFoodEntry(tx, &user, &entry); err != nil {
+				result.Error = err.Error()
+				failed = true
+			} else {
+				if err := tx.Omit("Food").Create(&entry).Error; err != nil {
+					return err
+				}
+				result.ID = entry.ID
+				result.Entry = &entry
+			}
+			results = append(results, result)
+		}
 
-	// Validate and process each food entry
-	for i := range foodSet.Entries {
-		entry := &foodSet.Entries[i]
-		entry.UserID = userID
+		for i, item := range batch.Update {
+			result := models.BatchItemResult{Operation: "update", Index: i, ID: item.ID}
+			var entry models.FoodEntry
+			if err := tx.Where("id = ? AND user_id = ?", item.ID, userID).First(&entry).Error; err != nil {
+				result.Error = "Food entry not found"
+				failed = true
+			} else {
+				item.Apply(&entry)
+				if err := prepareFoodEntry(tx, &user, &entry); err != nil {
+					result.Error = err.Error()
+					failed = true
+				} else {
+					if err := tx.Omit("Food").Save(&entry).Error; err != nil {
+						return err
+					}
+					result.Entry = &entry
+				}
+			}
+			results = append(results, result)
+		}
 
-		// Load food data and calculate calories
-		var food models.Food
-		if err := config.DB.First(&food, entry.FoodID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID in entry"})
-			return
+		for i, id := range batch.Delete {
+			result := models.BatchItemResult{Operation: "delete", Index: i, ID: id}
+			deleted, err := trashFoodEntry(tx, userID, id, undoToken)
+			if err != nil {
+				return err
+			}
+			if deleted == 0 {
+				result.Error = "Food entry not found"
+				failed = true
+			}
+			results = append(results, result)
 		}
 
-		// Find serving size
-		var serving models.FoodServing
-		if err := config.DB.Where("food_id = ? AND description = ?", entry.FoodID, entry.ServingDesc).
-			First(&serving).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid serving size"})
-			return
+		if failed {
+			return errBatchFailed
 		}
 
-		// Calculate calories
-		entry.Calories = float64(food.Calories) * serving.Grams * entry.Quantity / 100.0
-	}
+		// Load the associated food data for the response
+		for _, result := range results {
+			if result.Entry != nil {
+				if err := tx.Preload("Food").First(result.Entry, result.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
 
-	if err := config.DB.Create(&foodSet).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food set"})
+	if errors.Is(err, errBatchFailed) {
+		// Nothing was written, so no result may point at a stored entry
+		for i := range results {
+			results[i].ID = 0
+			results[i].Entry = nil
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Batch rolled back because some items are invalid",
+			"results": results,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error applying food entry batch for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply food entry batch"})
 		return
 	}
 
-	c.JSON(http.StatusOK, foodSet)
+	log.Printf("Applied food entry batch for user %d: %d created, %d updated, %d deleted",
+		userID, len(batch.Create), len(batch.Update), len(batch.Delete))
+
+	response := gin.H{"results": results}
+	if len(batch.Delete) > 0 {
+		response["undo_token"] = undoToken
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func getUserFoodSets(c *gin.Context) {
+func copyFoodEntries(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	var foodSets []models.FoodSet
 
-	if err := config.DB.Where("user_id = ?", userID).
-		Preload("Entries.Food").
-		Find(&foodSets).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food sets"})
+	var req models.CopyEntriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, foodSets)
-}
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
 
-func applyFoodSet(c *gin.Context) {
-	userID := c.GetUint("user_id")
+	if _, err := time.Parse("2006-01-02", req.FromDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidDate.Error()})
+		return
+	}
+	for _, date := range req.ToDates {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidDate.Error()})
+			return
+		}
+	}
+	meal := models.NormalizeMeal(req.Meal)
+	if meal != "" && meal != "unassigned" && !user.HasMeal(meal) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidMeal.Error()})
+		return
+	}
+
+	query := config.DB.Where("user_id = ? AND date = ?", userID, req.FromDate)
+	if meal == "unassigned" {
+		query = query.Where("meal = ''")
+	} else if meal != "" {
+		query = query.Where("meal = ?", meal)
+	}
+	var sources []models.FoodEntry
+	if err := query.Order("id").Find(&sources).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food entries"})
+		return
+	}
+	if len(sources) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No food entries to copy"})
+		return
+	}
+
+	created := []models.FoodEntry{}
+	skipped := []gin.H{}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, date := range req.ToDates {
+			var existing []models.FoodEntry
+			if req.SkipExisting {
+				if err := tx.Where("user_id = ? AND date = ?", userID, date).
+					Find(&existing).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, source := range sources {
+				entry := models.FoodEntry{
+					UserID:      userID,
+					FoodID:      source.FoodID,
+					ServingDesc: source.ServingDesc,
+					Quantity:    source.Quantity,
+					Date:        date,
+					Meal:        source.Meal,
+					Time:        source.Time,
+				}
+				if req.ToMeal != nil {
+					entry.Meal = *req.ToMeal
+				}
+
+				// Recalculate from the current servings and food values
+				if err := prepareFoodEntry(tx, &user, &entry); err != nil {
+					if errors.Is(err, errInvalidMeal) {
+						return err
+					}
+					skipped = append(skipped, gin.H{"entry_id": source.ID, "date": date, "reason": err.Error()})
+					continue
+				}
+
+				duplicate := false
+				for _, other := range existing {
+					if entry.SameItem(other) {
+						duplicate = true
+						break
+					}
+				}
+				if duplicate {
+					skipped = append(skipped, gin.H{"entry_id": source.ID, "date": date, "reason": "Already logged"})
+					continue
+				}
+
+				if err := tx.Omit("Food").Create(&entry).Error; err != nil {
+					return err
+				}
+				created = append(created, entry)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidMeal) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error copying food entries for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy food entries"})
+		return
+	}
+
+	// Load the associated food data for the response
+	for i := range created {
+		if err := config.DB.Preload("Food").First(&created[i], created[i].ID).Error; err != nil {
+			log.Printf("Error loading food data for response: %v", err)
+		}
+	}
+
+	log.Printf("Copied %d food entries from %s for user %d, skipped %d",
+		len(created), req.FromDate, userID, len(skipped))
+
+	c.JSON(http.StatusOK, gin.H{"created": created, "skipped": skipped})
+}
+
+func deleteFoodEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	entryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food entry not found"})
+		return
+	}
+
+	undoToken, err := models.NewRandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food entry"})
+		return
+	}
+	deleted, err := trashFoodEntry(config.DB, userID, uint(entryID), undoToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food entry"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Food entry deleted successfully",
+		"undo_token": undoToken,
+	})
+}
+
+// trashFoodEntry soft-deletes a user's entry and tags it with the undo
+// token of the delete call. It returns how many entries were deleted.
+func trashFoodEntry(db *gorm.DB, userID uint, entryID uint, undoToken string) (int64, error) {
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		entries := tx.Model(&models.FoodEntry{}).Where("id = ? AND user_id = ?", entryID, userID)
+		if err := entries.Update("undo_token", undoToken).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND user_id = ?", entryID, userID).Delete(&models.FoodEntry{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+func getTrashedFoodEntries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var entries []models.FoodEntry
+	if err := config.DB.Unscoped().Preload("Food").
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Where("deleted_at >= ?", time.Now().Add(-config.TrashRetention())).
+		Order("deleted_at desc").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted food entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func restoreFoodEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	entryID := c.Param("id")
+
+	restored, err := restoreFoodEntries(config.DB.Where("id = ?", entryID), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore food entry"})
+		return
+	}
+	if len(restored) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted food entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored[0])
+}
+
+func undoDeleteFoodEntries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req models.UndoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	restored, err := restoreFoodEntries(config.DB.Where("undo_token = ?", req.Token), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore food entries"})
+		return
+	}
+	if len(restored) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing to undo"})
+		return
+	}
+
+	log.Printf("Restored %d food entries for user %d", len(restored), userID)
+	c.JSON(http.StatusOK, restored)
+}
+
+// restoreFoodEntries brings back the user's deleted entries matching query
+// that are still within the trash retention and returns them with their
+// food data
+func restoreFoodEntries(query *gorm.DB, userID uint) ([]models.FoodEntry, error) {
+	var entries []models.FoodEntry
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(query).
+			Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+			Where("deleted_at >= ?", time.Now().Add(-config.TrashRetention())).
+			Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.ID
+		}
+		if err := tx.Unscoped().Model(&models.FoodEntry{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"deleted_at": nil, "undo_token": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Preload("Food").Where("id IN ?", ids).Order("id").Find(&entries).Error
+	})
+	return entries, err
+}
+
+func createDirectFoodEntry(c *gin.Context) {
+	var directEntry DirectFoodEntry
+	if err := c.ShouldBindJSON(&directEntry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	// Create the food
+	food := models.Food{
+		Name:        directEntry.Name,
+		Calories:    directEntry.Calories,
+		ServingSize: 100, // Default serving size of 100g
+	}
+
+	if err := config.DB.Create(&food).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food"})
+		return
+	}
+
+	// Calculate calories based on quantity
+	caloriesForQuantity := float64(directEntry.Calories) * float64(directEntry.Quantity) / 100.0
+
+	// Create the food entry
+	foodEntry := models.FoodEntry{
+		UserID:   userID,
+		FoodID:   food.ID,
+		Food:     food,
+		Quantity: float64(directEntry.Quantity),
+		Date:     directEntry.Date,
+		Calories: caloriesForQuantity,
+	}
+
+	if err := config.DB.Create(&foodEntry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, foodEntry)
+}
+
+func debugFoodEntries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var entries []models.FoodEntry
+
+	if err := config.DB.Where("user_id = ?", userID).
+		Preload("Food").
+		Find(&entries).Error; err != nil {
+		log.Printf("Error fetching food entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food entries"})
+		return
+	}
+
+	log.Printf("Found %d total food entries for user %d", len(entries), userID)
+	for i, entry := range entries {
+		log.Printf("Entry %d: Date: %s, Food ID: %d, Name: %s, Calories: %f",
+			i, entry.Date, entry.FoodID, entry.Food.Name, entry.Calories)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func createFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var foodSet models.FoodSet
+
+	if err := c.ShouldBindJSON(&foodSet); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	foodSet.UserID = userID
+	// New sets are private until they are shared
+	foodSet.Visibility = "private"
+	foodSet.SourceSetID = nil
+	foodSet.SourceOwner = ""
+	foodSet.ImportCount = 0
+
+	// Validate and process each item
+	for i := range foodSet.Entries {
+		if err := prepareFoodSetItem(config.DB, &foodSet.Entries[i]); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := config.DB.Omit("Entries.Food").Create(&foodSet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food set"})
+		return
+	}
+
+	c.JSON(http.StatusOK, foodSet)
+}
+
+// prepareFoodSetItem checks the food and serving of a set item and fills in
+// its serving grams, calories and macros
+func prepareFoodSetItem(db *gorm.DB, item *models.FoodSetItem) error {
+	var food models.Food
+	if err := db.First(&food, item.FoodID).Error; err != nil {
+		return errInvalidFood
+	}
+	// Existing items may keep a food that has since been retired
+	if food.RetiredAt != nil && item.ID == 0 {
+		return errRetiredFood
+	}
+
+	var serving models.FoodServing
+	if err := db.Where("food_id = ? AND description = ?", item.FoodID, item.ServingDesc).
+		First(&serving).Error; err != nil {
+		return errInvalidServing
+	}
+
+	item.ServingGrams = serving.Grams
+	item.SetNutrition(food)
+	item.Food = food
+	return nil
+}
+
+func getUserFoodSets(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var foodSets []models.FoodSet
+
+	if err := config.DB.Where("user_id = ?", userID).
+		Preload("Entries.Food").
+		Find(&foodSets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food sets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, foodSets)
+}
+
+// loadFoodSet loads one of the user's sets with its items and their foods
+func loadFoodSet(db *gorm.DB, userID uint, setID string, foodSet *models.FoodSet) error {
+	return db.Where("id = ? AND user_id = ?", setID, userID).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Entries.Food").
+		First(foodSet).Error
+}
+
+func getFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var foodSet models.FoodSet
+	if err := loadFoodSet(config.DB, userID, c.Param("id"), &foodSet); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, foodSet)
+}
+
+func updateFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
 	setID := c.Param("id")
-	date := c.Query("date")
 
-	if date == "" {
-		date = time.Now().Format("2006-01-02")
-	} else {
-		// Validate date format
-		if _, err := time.Parse("2006-01-02", date); err != nil {
+	var update models.FoodSetUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var foodSet models.FoodSet
+	if err := loadFoodSet(config.DB, userID, setID, &foodSet); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	if update.Name != nil {
+		foodSet.Name = *update.Name
+	}
+	if update.Description != nil {
+		foodSet.Description = *update.Description
+	}
+	var items []models.FoodSetItem
+	if update.Entries != nil {
+		items = *update.Entries
+		for i := range items {
+			items[i].ID = 0
+			items[i].FoodSetID = foodSet.ID
+			if err := prepareFoodSetItem(config.DB, &items[i]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Entries").Save(&foodSet).Error; err != nil {
+			return err
+		}
+		if update.Entries == nil {
+			return nil
+		}
+		// Replace the items
+		if err := tx.Where("food_set_id = ?", foodSet.ID).Delete(&models.FoodSetItem{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Omit("Food").Create(&items).Error
+	})
+	if err != nil {
+		log.Printf("Error updating food set %d: %v", foodSet.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food set"})
+		return
+	}
+
+	if err := loadFoodSet(config.DB, userID, setID, &foodSet); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load food set"})
+		return
+	}
+	c.JSON(http.StatusOK, foodSet)
+}
+
+func addFoodSetItem(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var foodSet models.FoodSet
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&foodSet).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	var item models.FoodSetItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item.ID = 0
+	item.FoodSetID = foodSet.ID
+	if err := prepareFoodSetItem(config.DB, &item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Omit("Food").Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item to food set"})
+		return
+	}
+	// Items are part of the set, so the set counts as changed
+	config.DB.Model(&foodSet).Update("updated_at", time.Now())
+
+	c.JSON(http.StatusOK, item)
+}
+
+// loadFoodSetItem loads an item of one of the user's sets
+func loadFoodSetItem(c *gin.Context, item *models.FoodSetItem) error {
+	return config.DB.Joins("JOIN food_sets ON food_sets.id = food_set_items.food_set_id").
+		Where("food_set_items.id = ? AND food_set_items.food_set_id = ?", c.Param("itemId"), c.Param("id")).
+		Where("food_sets.user_id = ? AND food_sets.deleted_at IS NULL", c.GetUint("user_id")).
+		First(item).Error
+}
+
+func updateFoodSetItem(c *gin.Context) {
+	var update models.FoodSetItemUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var item models.FoodSetItem
+	if err := loadFoodSetItem(c, &item); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set item not found"})
+		return
+	}
+
+	update.Apply(&item)
+	if err := prepareFoodSetItem(config.DB, &item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Omit("Food").Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food set item"})
+		return
+	}
+	config.DB.Model(&models.FoodSet{}).Where("id = ?", item.FoodSetID).Update("updated_at", time.Now())
+
+	c.JSON(http.StatusOK, item)
+}
+
+func deleteFoodSetItem(c *gin.Context) {
+	var item models.FoodSetItem
+	if err := loadFoodSetItem(c, &item); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set item not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food set item"})
+		return
+	}
+	config.DB.Model(&models.FoodSet{}).Where("id = ?", item.FoodSetID).Update("updated_at", time.Now())
+
+	c.JSON(http.StatusOK, gin.H{"message": "Food set item deleted successfully"})
+}
+
+// applyFoodSet logs the items of a set as entries. Optional query
+// parameters:
+//   - date and meal to log to, today and unassigned by default
+//   - items, a comma separated list of item IDs to log only some items
+//   - scale to multiply all quantities, or target_calories to scale the
+//     items to that many calories in total
+//
+// Items whose food was retired are skipped and listed in the response.
+func applyFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	setID := c.Param("id")
+	date := c.Query("date")
+	meal := models.NormalizeMeal(c.Query("meal"))
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.HasMeal(meal) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown meal"})
+		return
+	}
+
+	if date == "" {
+		date = user.Today()
+	} else {
+		// Validate date format
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+
+	scale := 1.0
+	var targetCalories float64
+	if c.Query("scale") != "" && c.Query("target_calories") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use either scale or target_calories"})
+		return
+	}
+	if value := c.Query("scale"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scale must be a positive number"})
+			return
+		}
+		scale = parsed
+	}
+	if value := c.Query("target_calories"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target calories must be a positive number"})
+			return
+		}
+		targetCalories = parsed
+	}
+
+	// Load the food set with full food data
+	var foodSet models.FoodSet
+	if err := loadFoodSet(config.DB, userID, setID, &foodSet); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	// Pick the items to log
+	items := foodSet.Entries
+	if value := c.Query("items"); value != "" {
+		byID := make(map[string]models.FoodSetItem)
+		for _, item := range foodSet.Entries {
+			byID[strconv.FormatUint(uint64(item.ID), 10)] = item
+		}
+		items = nil
+		for _, id := range splitList(value) {
+			item, ok := byID[id]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Item " + id + " is not in this food set"})
+				return
+			}
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Food set has no items to apply"})
+		return
+	}
+
+	// Create new entries from the current food data. Merged foods are
+	// replaced by the food they were merged into and retired foods skipped.
+	var newEntries []models.FoodEntry
+	var applied []models.FoodSetItem
+	skipped := []gin.H{}
+	var calories float64
+	for _, item := range items {
+		if item.Food.MergedIntoID != nil {
+			var survivor models.Food
+			if err := config.DB.First(&survivor, *item.Food.MergedIntoID).Error; err == nil {
+				item.FoodID = survivor.ID
+				item.Food = survivor
+			}
+		}
+		entry := models.FoodEntry{
+			UserID:      userID,
+			FoodID:      item.FoodID,
+			ServingDesc: item.ServingDesc,
+			Quantity:    item.Quantity,
+			Date:        date,
+			Meal:        meal,
+		}
+		if err := prepareFoodEntry(config.DB, &user, &entry); err != nil {
+			if errors.Is(err, errRetiredFood) {
+				skipped = append(skipped, gin.H{"item_id": item.ID, "food_id": item.FoodID, "reason": err.Error()})
+				continue
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		calories += entry.Calories
+		newEntries = append(newEntries, entry)
+		applied = append(applied, item)
+	}
+	if len(newEntries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "None of the foods in the set are available", "skipped": skipped})
+		return
+	}
+	if targetCalories > 0 {
+		if calories == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Food set has no calories to scale"})
+			return
+		}
+		scale = targetCalories / calories
+	}
+	for i := range newEntries {
+		newEntries[i].Quantity = models.ScaleQuantity(newEntries[i].Quantity, scale)
+		if newEntries[i].Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scaled quantities are too small to log"})
+			return
+		}
+		newEntries[i].SetNutrition(applied[i].Food)
+	}
+
+	// Save all new entries
+	if err := config.DB.Omit("Food").Create(&newEntries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entries"})
+		return
+	}
+	for i := range newEntries {
+		newEntries[i].Food = applied[i].Food
+	}
+
+	c.JSON(http.StatusOK, gin.H{"created": newEntries, "skipped": skipped})
+}
+
+func shareFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req models.ShareFoodSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var foodSet models.FoodSet
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&foodSet).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	// Look up the users to share with. Addresses without an account become
+	// pending shares, so the response doesn't tell which ones are registered.
+	var emails []string
+	if req.Emails != nil {
+		for _, email := range *req.Emails {
+			if email = strings.ToLower(email); !slices.Contains(emails, email) {
+				emails = append(emails, email)
+			}
+		}
+	}
+	recipients := map[string]uint{}
+	if len(emails) > 0 {
+		var users []models.User
+		if err := config.DB.Where("LOWER(email) IN ?", emails).Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up users"})
+			return
+		}
+		for _, user := range users {
+			recipients[strings.ToLower(user.Email)] = user.ID
+		}
+	}
+
+	if req.Visibility != "" {
+		foodSet.Visibility = req.Visibility
+	}
+	if foodSet.Visibility == "private" && req.Emails != nil && len(*req.Emails) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set visibility to link or public to share with users"})
+		return
+	}
+	if foodSet.Visibility == "private" {
+		foodSet.ShareToken = nil
+	} else if foodSet.ShareToken == nil {
+		token, err := models.NewRandomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share food set"})
+			return
+		}
+		foodSet.ShareToken = &token
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&foodSet).Select("visibility", "share_token").Updates(&foodSet).Error; err != nil {
+			return err
+		}
+		if req.Emails == nil && foodSet.Visibility != "private" {
+			return nil
+		}
+		if err := tx.Unscoped().Where("food_set_id = ?", foodSet.ID).Delete(&models.FoodSetShare{}).Error; err != nil {
+			return err
+		}
+		for _, email := range emails {
+			// Sharing with yourself is a no-op
+			if recipients[email] == userID {
+				continue
+			}
+			share := models.FoodSetShare{FoodSetID: foodSet.ID, UserID: recipients[email], Email: email}
+			if err := tx.Create(&share).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error sharing food set %d: %v", foodSet.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share food set"})
+		return
+	}
+
+	sharedWith := []string{}
+	if err := config.DB.Model(&models.FoodSetShare{}).Where("food_set_id = ?", foodSet.ID).
+		Order("email").Pluck("email", &sharedWith).Error; err != nil {
+		log.Printf("Error loading food set shares: %v", err)
+	}
+
+	response := gin.H{
+		"visibility":  foodSet.Visibility,
+		"shared_with": sharedWith,
+	}
+	if foodSet.ShareToken != nil {
+		response["share_token"] = *foodSet.ShareToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// sharedFoodSets loads sets of other users matching query, with their items
+// and the names of their owners
+func sharedFoodSets(query *gorm.DB) ([]models.SharedFoodSet, error) {
+	var foodSets []models.FoodSet
+	if err := query.Preload("Entries.Food").Find(&foodSets).Error; err != nil {
+		return nil, err
+	}
+
+	ownerIDs := make([]uint, len(foodSets))
+	for i, foodSet := range foodSets {
+		ownerIDs[i] = foodSet.UserID
+	}
+	var owners []models.User
+	if err := config.DB.Where("id IN ?", ownerIDs).Find(&owners).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string)
+	for _, owner := range owners {
+		names[owner.ID] = owner.Name
+	}
+
+	shared := make([]models.SharedFoodSet, len(foodSets))
+	for i, foodSet := range foodSets {
+		shared[i] = models.SharedFoodSet{FoodSet: foodSet, Owner: names[foodSet.UserID]}
+	}
+	return shared, nil
+}
+
+func getSharedFoodSets(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	shared, err := sharedFoodSets(config.DB.
+		Where("id IN (?)", config.DB.Model(&models.FoodSetShare{}).Select("food_set_id").Where("user_id = ?", userID)).
+		Where("visibility <> ?", "private").
+		Order("id desc"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shared food sets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shared)
+}
+
+// getFoodSetLibrary lists public food sets. They can be searched by name
+// with q and sorted by "popular" (most imported, the default) or "newest".
+func getFoodSetLibrary(c *gin.Context) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be a positive number"})
+			return
+		}
+		limit = parsed
+	}
+
+	query := config.DB.Where("visibility = ?", "public")
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(q)+"%")
+	}
+	switch c.DefaultQuery("sort", "popular") {
+	case "popular":
+		query = query.Order("import_count desc, id desc")
+	case "newest":
+		query = query.Order("id desc")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sort must be popular or newest"})
+		return
+	}
+
+	library, err := sharedFoodSets(query.Limit(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food set library"})
+		return
+	}
+
+	c.JSON(http.StatusOK, library)
+}
+
+func getLinkedFoodSet(c *gin.Context) {
+	shared, err := sharedFoodSets(config.DB.
+		Where("share_token = ? AND visibility <> ?", c.Param("token"), "private"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food set"})
+		return
+	}
+	if len(shared) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shared[0])
+}
+
+// importFoodSet copies a set the user can see into their own sets. Sets
+// shared by link need the share token in the token query parameter.
+func importFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var source models.FoodSet
+	if err := config.DB.Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Entries.Food").First(&source, c.Param("id")).Error; err != nil ||
+		!canViewFoodSet(source, userID, c.Query("token")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+	if source.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Food set is already yours"})
+		return
+	}
+
+	var owner models.User
+	config.DB.First(&owner, source.UserID)
+
+	imported := models.FoodSet{
+		UserID:      userID,
+		Name:        source.Name,
+		Description: source.Description,
+		Visibility:  "private",
+		SourceSetID: &source.ID,
+		SourceOwner: owner.Name,
+	}
+	for _, item := range source.Entries {
+		imported.Entries = append(imported.Entries, models.FoodSetItem{
+			FoodID:        item.FoodID,
+			Food:          item.Food,
+			ServingDesc:   item.ServingDesc,
+			ServingGrams:  item.ServingGrams,
+			Quantity:      item.Quantity,
+			Calories:      item.Calories,
+			Protein:       item.Protein,
+			Carbohydrates: item.Carbohydrates,
+			Fat:           item.Fat,
+		})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Entries.Food").Create(&imported).Error; err != nil {
+			return err
+		}
+		return tx.Model(&source).UpdateColumn("import_count", gorm.Expr("import_count + 1")).Error
+	})
+	if err != nil {
+		log.Printf("Error importing food set %d: %v", source.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import food set"})
+		return
+	}
+
+	c.JSON(http.StatusOK, imported)
+}
+
+// canViewFoodSet reports whether the user may see another user's set
+func canViewFoodSet(foodSet models.FoodSet, userID uint, token string) bool {
+	switch {
+	case foodSet.UserID == userID, foodSet.Visibility == "public":
+		return true
+	case foodSet.Visibility == "private":
+		return false
+	case foodSet.Visibility == "link" && foodSet.ShareToken != nil && token == *foodSet.ShareToken:
+		return true
+	}
+	var shares int64
+	config.DB.Model(&models.FoodSetShare{}).
+		Where("food_set_id = ? AND user_id = ?", foodSet.ID, userID).Count(&shares)
+	return shares > 0
+}
+
+func deleteFoodSet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	setID := c.Param("id")
+
+	// First verify the food set belongs to the user
+	var foodSet models.FoodSet
+	if err := config.DB.Where("id = ? AND user_id = ?", setID, userID).First(&foodSet).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+		return
+	}
+
+	// Delete the food set along with its items and the rules logging it
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("food_set_id = ?", foodSet.ID).Delete(&models.RecurringEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Select("Entries").Delete(&foodSet).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food set"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Food set deleted successfully"})
+}
+
+// getWeeklyStats summarizes the days from startDate to endDate, with
+// totals per day and averages over the days that have entries
+func getWeeklyStats(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	startDate := c.Query("startDate")
+	endDate := c.Query("endDate")
+
+	dates, err := models.StatsRange(startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var foodEntries []models.FoodEntry
+	if err := config.DB.Where("user_id = ? AND date BETWEEN ? AND ?", userID, startDate, endDate).
+		Find(&foodEntries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food entries"})
+		return
+	}
+
+	// Get user's needed calories and macros
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewWeeklyStats(foodEntries, dates, user.CalculateMacroTargets(), user.Meals()))
+}
+
+// getAnalytics returns calories, macros, entry counts and weight bucketed
+// by day, week or month, aggregated in the database. Query parameters are
+// bucket (day by default) and the from and to dates, which default to the
+// last 30 days, 12 weeks or 12 months up to today.
+func getAnalytics(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	bucket := c.DefaultQuery("bucket", "day")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	to := c.DefaultQuery("to", user.Today())
+	from := c.Query("from")
+	if from == "" {
+		if end, err := time.Parse("2006-01-02", to); err == nil {
+			switch bucket {
+			case "week":
+				from = models.BucketStart(bucket, end).AddDate(0, 0, -7*11).Format("2006-01-02")
+			case "month":
+				from = models.BucketStart(bucket, end).AddDate(0, -11, 0).Format("2006-01-02")
+			default:
+				from = end.AddDate(0, 0, -29).Format("2006-01-02")
+			}
+		}
+	}
+	if err := models.AnalyticsRange(bucket, from, to); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rows []models.AnalyticsRow
+	if err := config.DB.Model(&models.FoodEntry{}).
+		Select(models.BucketSQL(bucket, "date")+` AS bucket, SUM(calories) AS calories,
+			SUM(COALESCE(protein, 0)) AS protein, SUM(COALESCE(carbohydrates, 0)) AS carbohydrates,
+			SUM(COALESCE(fat, 0)) AS fat, COUNT(*) AS entries, COUNT(DISTINCT date) AS days_logged`).
+		Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to).
+		Group("bucket").
+		Scan(&rows).Error; err != nil {
+		log.Printf("Error aggregating food entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	var weights []models.WeightRow
+	if err := config.DB.Model(&models.WeightLog{}).
+		Select(models.BucketSQL(bucket, "date")+" AS bucket, AVG(weight) AS weight").
+		Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to).
+		Group("bucket").
+		Scan(&weights).Error; err != nil {
+		log.Printf("Error aggregating weight logs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bucket":  bucket,
+		"from":    from,
+		"to":      to,
+		"targets": user.CalculateMacroTargets(),
+		"points":  models.AnalyticsSeries(bucket, from, to, rows, weights),
+	})
+}
+
+// getStreaks returns the current and best streaks of days with entries
+// and of days within the calorie target, and the adherence score of the
+// last 30 days. Days are scored against the user's current targets.
+func getStreaks(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	today := user.Today()
+
+	var days []models.AnalyticsRow
+	if err := config.DB.Model(&models.FoodEntry{}).
+		Select(`date AS bucket, SUM(calories) AS calories,
+			SUM(COALESCE(protein, 0)) AS protein, SUM(COALESCE(carbohydrates, 0)) AS carbohydrates,
+			SUM(COALESCE(fat, 0)) AS fat, COUNT(*) AS entries, 1 AS days_logged`).
+		Where("user_id = ? AND date <= ?", userID, today).
+		Group("date").
+		Order("date").
+		Scan(&days).Error; err != nil {
+		log.Printf("Error aggregating food entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch streaks"})
+		return
+	}
+
+	targets := user.CalculateMacroTargets()
+	logging, onTarget := models.Streaks(days, today, targets)
+
+	end, _ := time.Parse("2006-01-02", today)
+	dates, _ := models.DatesBetween(end.AddDate(0, 0, 1-models.AdherenceDays).Format("2006-01-02"), today)
+	history := models.AdherenceHistory(days, dates, targets)
+
+	c.JSON(http.StatusOK, gin.H{
+		"logging":          logging,
+		"onTarget":         onTarget,
+		"targets":          targets,
+		"averageAdherence": models.AverageAdherence(history),
+		"adherence":        history,
+	})
+}
+
+func getDuplicateFoods(c *gin.Context) {
+	threshold := 0.8
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Threshold must be a number between 0 and 1"})
+			return
+		}
+		threshold = parsed
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be a positive number"})
+			return
+		}
+		limit = parsed
+	}
+
+	var foods []models.Food
+	if err := config.DB.Where("retired_at IS NULL").Find(&foods).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+
+	candidates := models.FindDuplicateCandidates(foods, threshold)
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	c.JSON(http.StatusOK, candidates)
+}
+
+func mergeFoods(c *gin.Context) {
+	var req models.MergeFoodsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Repeated IDs would make the lookup below come up short
+	seen := make(map[uint]bool)
+	var duplicateIDs []uint
+	for _, id := range req.DuplicateIDs {
+		if !seen[id] {
+			seen[id] = true
+			duplicateIDs = append(duplicateIDs, id)
+		}
+	}
+	req.DuplicateIDs = duplicateIDs
+
+	var survivor models.Food
+	if err := config.DB.First(&survivor, req.SurvivorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Surviving food not found"})
+		return
+	}
+	if survivor.MergedIntoID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Surviving food has already been merged"})
+		return
+	}
+
+	var duplicates []models.Food
+	if err := config.DB.Where("id IN ?", req.DuplicateIDs).Find(&duplicates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+	if len(duplicates) != len(req.DuplicateIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duplicate food not found"})
+		return
+	}
+	for _, duplicate := range duplicates {
+		if duplicate.ID == survivor.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A food cannot be merged into itself"})
+			return
+		}
+		if duplicate.MergedIntoID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Food " + duplicate.Name + " has already been merged"})
+			return
+		}
+	}
+
+	var entriesUpdated, servingsMoved int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Re-point diary entries, food set items, planned items and recurring
+		// entries, including deleted ones
+		result := tx.Unscoped().Model(&models.FoodEntry{}).
+			Where("food_id IN ?", req.DuplicateIDs).
+			Update("food_id", survivor.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		entriesUpdated = result.RowsAffected
+		result = tx.Unscoped().Model(&models.FoodSetItem{}).
+			Where("food_id IN ?", req.DuplicateIDs).
+			Update("food_id", survivor.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		entriesUpdated += result.RowsAffected
+		result = tx.Unscoped().Model(&models.PlannedEntry{}).
+			Where("food_id IN ?", req.DuplicateIDs).
+			Update("food_id", survivor.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		entriesUpdated += result.RowsAffected
+		if err := tx.Unscoped().Model(&models.RecurringEntry{}).Where("food_id IN ?", req.DuplicateIDs).
+			Update("food_id", survivor.ID).Error; err != nil {
+			return err
+		}
+
+		// Move favorites, keeping one per user
+		if err := tx.Unscoped().Where("food_id IN ? AND user_id IN (?)", req.DuplicateIDs,
+			tx.Unscoped().Model(&models.FavoriteFood{}).Select("user_id").Where("food_id = ?", survivor.ID)).
+			Delete(&models.FavoriteFood{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("food_id IN ? AND id NOT IN (?)", req.DuplicateIDs,
+			tx.Unscoped().Model(&models.FavoriteFood{}).Select("MIN(id)").Where("food_id IN ?", req.DuplicateIDs).Group("user_id")).
+			Delete(&models.FavoriteFood{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.FavoriteFood{}).Where("food_id IN ?", req.DuplicateIDs).
+			Update("food_id", survivor.ID).Error; err != nil {
+			return err
+		}
+
+		// Move servings the survivor doesn't have yet, drop the rest
+		var survivorServings []models.FoodServing
+		if err := tx.Where("food_id = ?", survivor.ID).Find(&survivorServings).Error; err != nil {
+			return err
+		}
+		known := make(map[string]bool)
+		for _, serving := range survivorServings {
+			known[serving.Description] = true
+		}
+
+		var servings []models.FoodServing
+		if err := tx.Where("food_id IN ?", req.DuplicateIDs).Find(&servings).Error; err != nil {
+			return err
+		}
+		for _, serving := range servings {
+			if known[serving.Description] {
+				if err := tx.Delete(&serving).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			known[serving.Description] = true
+			if err := tx.Model(&serving).Update("food_id", survivor.ID).Error; err != nil {
+				return err
+			}
+			servingsMoved++
+		}
+
+		// Foods merged into a duplicate earlier now point at the survivor too
+		if err := tx.Model(&models.Food{}).Where("merged_into_id IN ?", req.DuplicateIDs).
+			Update("merged_into_id", survivor.ID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Food{}).Where("id IN ?", req.DuplicateIDs).Updates(map[string]interface{}{
+			"merged_into_id": survivor.ID,
+			"retired_at":     time.Now(),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Error merging foods into %d: %v", survivor.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge foods"})
+		return
+	}
+
+	log.Printf("Merged foods %v into %d (%s): %d entries updated, %d servings moved",
+		req.DuplicateIDs, survivor.ID, survivor.Name, entriesUpdated, servingsMoved)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Foods merged successfully",
+		"survivor":       survivor,
+		"entriesUpdated": entriesUpdated,
+		"servingsMoved":  servingsMoved,
+	})
+}
+
+func updateFoodDietary(c *gin.Context) {
+	var req models.FoodDietaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var food models.Food
+	if err := config.DB.First(&food, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+
+	// Store empty lists as [] so the catalog sync doesn't infer them again
+	food.Tags = []string{}
+	if req.Tags != nil {
+		food.Tags = req.Tags
+	}
+	food.Allergens = []string{}
+	if req.Allergens != nil {
+		food.Allergens = req.Allergens
+	}
+
+	if err := config.DB.Model(&food).Select("tags", "allergens").Updates(&food).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food"})
+		return
+	}
+
+	c.JSON(http.StatusOK, food)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func favoriteFoodIDs(userID uint) (map[uint]bool, error) {
+	var ids []uint
+	if err := config.DB.Model(&models.FavoriteFood{}).Where("user_id = ?", userID).
+		Pluck("food_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	favorites := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		favorites[id] = true
+	}
+	return favorites, nil
+}
+
+func addFavoriteFood(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var food models.Food
+	if err := config.DB.Where("retired_at IS NULL").First(&food, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+
+	favorite := models.FavoriteFood{UserID: userID, FoodID: food.ID}
+	if err := config.DB.Where(&favorite).FirstOrCreate(&favorite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add favorite food"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Food added to favorites"})
+}
+
+func removeFavoriteFood(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	result := config.DB.Unscoped().Where("user_id = ? AND food_id = ?", userID, c.Param("id")).
+		Delete(&models.FavoriteFood{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove favorite food"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Favorite food not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Food removed from favorites"})
+}
+
+func getFavoriteFoods(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var favorites []models.FavoriteFood
+	if err := config.DB.Where("user_id = ?", userID).
+		Preload("Food.Servings").
+		Order("created_at desc").
+		Find(&favorites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorite foods"})
+		return
+	}
+
+	foods := []models.Food{}
+	for _, favorite := range favorites {
+		foods = append(foods, favorite.Food)
+	}
+
+	c.JSON(http.StatusOK, foods)
+}
+
+func getRecentFoods(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be a positive number"})
+			return
+		}
+		limit = parsed
+	}
+
+	// The most recently created entry of each food that can still be logged
+	latest := config.DB.Model(&models.FoodEntry{}).
+		Select("MAX(id)").
+		Where("user_id = ?", userID).
+		Where("food_id IN (?)", config.DB.Model(&models.Food{}).Select("id").Where("retired_at IS NULL")).
+		Group("food_id")
+
+	var entries []models.FoodEntry
+	if err := config.DB.Where("id IN (?)", latest).
+		Preload("Food.Servings").
+		Order("id desc").
+		Limit(limit).
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recent foods"})
+		return
+	}
+
+	type foodCount struct {
+		FoodID uint
+		Count  int
+	}
+	var counts []foodCount
+	if err := config.DB.Model(&models.FoodEntry{}).
+		Select("food_id, COUNT(*) AS count").
+		Where("user_id = ?", userID).
+		Group("food_id").
+		Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recent foods"})
+		return
+	}
+	timesLogged := make(map[uint]int, len(counts))
+	for _, count := range counts {
+		timesLogged[count.FoodID] = count.Count
+	}
+
+	favorites, err := favoriteFoodIDs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorite foods"})
+		return
+	}
+
+	recent := []models.RecentFood{}
+	for _, entry := range entries {
+		recent = append(recent, models.RecentFood{
+			Food:         entry.Food,
+			ServingDesc:  entry.ServingDesc,
+			ServingGrams: entry.ServingGrams,
+			Quantity:     entry.Quantity,
+			Calories:     entry.Calories,
+			LastUsed:     entry.Date,
+			TimesLogged:  timesLogged[entry.FoodID],
+			Favorite:     favorites[entry.FoodID],
+		})
+	}
+
+	c.JSON(http.StatusOK, recent)
+}
+
+func parseFoodEntries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req models.QuickAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if req.Date == "" {
+		req.Date = user.Today()
+	} else if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+	req.Meal = models.NormalizeMeal(req.Meal)
+	if !user.HasMeal(req.Meal) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown meal"})
+		return
+	}
+
+	items := models.ParseFoodText(req.Text)
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No foods found in text"})
+		return
+	}
+
+	var foods []models.Food
+	if err := config.DB.Where("retired_at IS NULL").Preload("Servings").Find(&foods).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+
+	proposals := make([]models.QuickAddProposal, 0, len(items))
+	for _, item := range items {
+		matches := models.MatchParsedItem(item, foods, 4)
+		for i := range matches {
+			matches[i].Entry.UserID = userID
+			matches[i].Entry.Date = req.Date
+			matches[i].Entry.Meal = req.Meal
+		}
+
+		proposal := models.QuickAddProposal{ParsedItem: item, Alternatives: []models.FoodMatch{}}
+		if len(matches) > 0 {
+			proposal.Match = &matches[0]
+			proposal.Alternatives = matches[1:]
+		}
+		proposals = append(proposals, proposal)
+	}
+
+	if !req.Commit {
+		c.JSON(http.StatusOK, gin.H{"items": proposals})
+		return
+	}
+
+	minConfidence := models.DefaultMinConfidence
+	if req.MinConfidence != nil {
+		minConfidence = *req.MinConfidence
+	}
+
+	created := []models.FoodEntry{}
+	skipped := []string{}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, proposal := range proposals {
+			if proposal.Match == nil || proposal.Match.Confidence < minConfidence {
+				skipped = append(skipped, proposal.Text)
+				continue
+			}
+
+			entry := proposal.Match.Entry
+			if err := prepareFoodEntry(tx, &user, &entry); err != nil {
+				log.Printf("Skipping parsed item %q: %v", proposal.Text, err)
+				skipped = append(skipped, proposal.Text)
+				continue
+			}
+			if err := tx.Omit("Food").Create(&entry).Error; err != nil {
+				return err
+			}
+			created = append(created, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error committing parsed food entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entries"})
+		return
+	}
+
+	log.Printf("Quick add for user %d: %d entries created, %d skipped", userID, len(created), len(skipped))
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":   proposals,
+		"created": created,
+		"skipped": skipped,
+	})
+}
+
+// pullChanges returns everything that changed for the user since the sync
+// token in the query. Without a token everything is returned. The response
+// includes the token to pass on the next pull.
+func pullChanges(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var since models.SyncToken
+	if value := c.Query("token"); value != "" {
+		token, err := models.DecodeSyncToken(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync token"})
+			return
+		}
+		since = token
+		// Deletions older than the trash retention have been purged
+		if time.Time(since).Before(time.Now().Add(-config.TrashRetention())) {
+			c.JSON(http.StatusGone, gin.H{"error": "Sync token expired, pull again without a token"})
+			return
+		}
+	}
+	sinceDay := since.JulianDay()
+	if c.Query("token") == "" {
+		sinceDay = 0
+	}
+
+	var user models.User
+	var next models.SyncToken
+	entries := models.SyncChanges[models.FoodEntry]{Updated: []models.FoodEntry{}, Deleted: []uint{}}
+	foodSets := models.SyncChanges[models.FoodSet]{Updated: []models.FoodSet{}, Deleted: []uint{}}
+	var foods []models.Food
+
+	// Read everything from one snapshot, which also gives the next token
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var now float64
+		if err := tx.Raw("SELECT julianday('now')").Scan(&now).Error; err != nil {
+			return err
+		}
+		next = models.SyncTokenFromJulianDay(now)
+
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Food").
+			Where("user_id = ? AND julianday(updated_at) > ?", userID, sinceDay).
+			Order("id").Find(&entries.Updated).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.FoodEntry{}).
+			Where("user_id = ? AND julianday(deleted_at) > ?", userID, sinceDay).
+			Order("id").Pluck("id", &entries.Deleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Entries.Food").
+			Where("user_id = ? AND julianday(updated_at) > ?", userID, sinceDay).
+			Order("id").Find(&foodSets.Updated).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.FoodSet{}).
+			Where("user_id = ? AND julianday(deleted_at) > ?", userID, sinceDay).
+			Order("id").Pluck("id", &foodSets.Deleted).Error; err != nil {
+			return err
+		}
+		// Foods are shared by all users; retired foods are included so
+		// clients can stop offering them
+		return tx.Preload("Servings").Where("julianday(updated_at) > ?", sinceDay).
+			Order("id").Find(&foods).Error
+	})
+	if err != nil {
+		log.Printf("Error pulling changes for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch changes"})
+		return
+	}
+
+	response := gin.H{
+		"sync_token": next.Encode(),
+		"entries":    entries,
+		"food_sets":  foodSets,
+		"foods":      foods,
+	}
+	if sinceDay == 0 || user.UpdatedAt.After(time.Time(since)) {
+		response["profile"] = profileResponse(&user)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// pushChanges applies entry changes a client made while offline. Each change
+// is applied on its own, so one conflict does not hold back the others.
+func pushChanges(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var push models.SyncPush
+	if err := c.ShouldBindJSON(&push); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if push.Strategy == "" {
+		push.Strategy = "version"
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	results := make([]models.SyncResult, 0, len(push.Entries))
+	for _, change := range push.Entries {
+		results = append(results, applyEntryChange(&user, change, push.Strategy))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func applyEntryChange(user *models.User, change models.SyncEntryChange, strategy string) models.SyncResult {
+	result := models.SyncResult{ClientID: change.ClientID, ID: change.ID, Status: "applied"}
+	fail := func(err error) models.SyncResult {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	if !change.Deleted && change.Quantity == nil {
+		return fail(errors.New("quantity is required"))
+	}
+
+	// New entries
+	if change.ID == 0 {
+		if change.Deleted {
+			return result
+		}
+		entry := models.FoodEntry{UserID: user.ID}
+		change.Apply(&entry)
+		if err := prepareFoodEntry(config.DB, user, &entry); err != nil {
+			return fail(err)
+		}
+		if err := config.DB.Omit("Food").Create(&entry).Error; err != nil {
+			log.Printf("Error creating synced food entry: %v", err)
+			return fail(errors.New("Failed to create food entry"))
+		}
+		config.DB.Preload("Food").First(&entry, entry.ID)
+		result.ID = entry.ID
+		result.Entry = &entry
+		return result
+	}
+
+	var entry models.FoodEntry
+	if err := config.DB.Unscoped().Preload("Food").
+		Where("id = ? AND user_id = ?", change.ID, user.ID).
+		First(&entry).Error; err != nil {
+		return fail(errors.New("Food entry not found"))
+	}
+
+	if entry.DeletedAt.Valid {
+		if change.Deleted {
+			return result
+		}
+		// Entries past the trash retention can't come back
+		if entry.DeletedAt.Time.Before(time.Now().Add(-config.TrashRetention())) {
+			return fail(errors.New("Food entry not found"))
+		}
+		// Edits made after the entry was deleted bring it back
+		if strategy != "last_write_wins" || change.ChangedAt.Before(entry.DeletedAt.Time) {
+			result.Status = "conflict"
+			result.Entry = &entry
+			return result
+		}
+		entry.DeletedAt = gorm.DeletedAt{}
+		entry.UndoToken = ""
+	} else if change.ConflictsWith(entry, strategy) {
+		result.Status = "conflict"
+		result.Entry = &entry
+		return result
+	}
+
+	if change.Deleted {
+		undoToken, err := models.NewRandomToken()
+		if err != nil {
+			return fail(errors.New("Failed to delete food entry"))
+		}
+		if _, err := trashFoodEntry(config.DB, user.ID, entry.ID, undoToken); err != nil {
+			return fail(errors.New("Failed to delete food entry"))
+		}
+		return result
+	}
+
+	// Existing entries may keep a retired food but not switch to one
+	if change.FoodID != entry.FoodID {
+		var food models.Food
+		if err := config.DB.First(&food, change.FoodID).Error; err == nil && food.RetiredAt != nil {
+			return fail(errRetiredFood)
+		}
+	}
+	change.Apply(&entry)
+	if err := prepareFoodEntry(config.DB, user, &entry); err != nil {
+		return fail(err)
+	}
+	if err := config.DB.Unscoped().Omit("Food").Save(&entry).Error; err != nil {
+		log.Printf("Error saving synced food entry: %v", err)
+		return fail(errors.New("Failed to update food entry"))
+	}
+	config.DB.Preload("Food").First(&entry, entry.ID)
+	result.Entry = &entry
+	return result
+}
+
+// preparePlannedEntry validates a planned item like a food entry and fills
+// in its serving grams, calories and macros
+func preparePlannedEntry(db *gorm.DB, user *models.User, planned *models.PlannedEntry) error {
+	entry := planned.ToFoodEntry()
+	entry.ID = planned.ID
+	if err := prepareFoodEntry(db, user, &entry); err != nil {
+		return err
+	}
+	planned.SetFromEntry(entry)
+	return nil
+}
+
+func createPlannedEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var planned models.PlannedEntry
+	if err := c.ShouldBindJSON(&planned); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	planned.UserID = userID
+	planned.FoodEntryID = nil
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := preparePlannedEntry(config.DB, &user, &planned); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Omit("Food").Create(&planned).Error; err != nil {
+		log.Printf("Error creating planned entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create planned entry"})
+		return
+	}
+	config.DB.Preload("Food").First(&planned, planned.ID)
+
+	c.JSON(http.StatusOK, planned)
+}
+
+func updatePlannedEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var update models.FoodEntryUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var planned models.PlannedEntry
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&planned).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Planned entry not found"})
+		return
+	}
+	if planned.FoodEntryID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Planned entry was already eaten, edit the food entry instead"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	entry := planned.ToFoodEntry()
+	entry.ID = planned.ID
+	update.Apply(&entry)
+	if err := prepareFoodEntry(config.DB, &user, &entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	planned.SetFromEntry(entry)
+
+	if err := config.DB.Omit("Food").Save(&planned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update planned entry"})
+		return
+	}
+	config.DB.Preload("Food").First(&planned, planned.ID)
+
+	c.JSON(http.StatusOK, planned)
+}
+
+func deletePlannedEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	result := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.PlannedEntry{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete planned entry"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Planned entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Planned entry deleted successfully"})
+}
+
+// eatPlannedEntry logs a planned item as a food entry. The quantity, date
+// and time can be changed in the request body, e.g. for a smaller portion.
+func eatPlannedEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req models.EatRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var planned models.PlannedEntry
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&planned).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Planned entry not found"})
+		return
+	}
+	if planned.FoodEntryID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": errAlreadyEaten.Error()})
+		return
+	}
+
+	entry := planned.ToFoodEntry()
+	if req.Quantity != nil {
+		entry.Quantity = *req.Quantity
+	}
+	if req.Date != nil {
+		entry.Date = *req.Date
+	}
+	if req.Time != nil {
+		entry.Time = *req.Time
+	}
+	if err := prepareFoodEntry(config.DB, &user, &entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Food").Create(&entry).Error; err != nil {
+			return err
+		}
+		// Only one request can mark the item as eaten
+		result := tx.Model(&planned).Where("food_entry_id IS NULL").Update("food_entry_id", entry.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyEaten
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyEaten) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking planned entry %d as eaten: %v", planned.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log planned entry"})
+		return
+	}
+
+	config.DB.Preload("Food").First(&entry, entry.ID)
+	c.JSON(http.StatusOK, entry)
+}
+
+// planRange reads the from and to query parameters of the plan endpoints.
+// They default to the user's current week, Monday to Sunday.
+func planRange(c *gin.Context, user *models.User) ([]string, bool) {
+	from, to := models.WeekOf(user.Now())
+	if value := c.Query("from"); value != "" {
+		from = value
+	}
+	if value := c.Query("to"); value != "" {
+		to = value
+	}
+
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return nil, false
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return nil, false
+	}
+	// Check the span before listing the dates
+	if end.Before(start) || end.Sub(start) >= 62*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range must cover 1 to 62 days"})
+		return nil, false
+	}
+
+	dates, err := models.DatesBetween(from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return nil, false
+	}
+	return dates, true
+}
+
+// loadPlanAndEntries loads the user's planned items and logged entries in
+// the date range, grouped by date
+func loadPlanAndEntries(userID uint, dates []string) (map[string][]models.PlannedEntry, map[string][]models.FoodEntry, error) {
+	from, to := dates[0], dates[len(dates)-1]
+
+	var planned []models.PlannedEntry
+	if err := config.DB.Preload("Food").
+		Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to).
+		Order("date, time, id").Find(&planned).Error; err != nil {
+		return nil, nil, err
+	}
+	var entries []models.FoodEntry
+	if err := config.DB.Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to).
+		Find(&entries).Error; err != nil {
+		return nil, nil, err
+	}
+
+	plannedByDate := make(map[string][]models.PlannedEntry)
+	for _, item := range planned {
+		plannedByDate[item.Date] = append(plannedByDate[item.Date], item)
+	}
+	entriesByDate := make(map[string][]models.FoodEntry)
+	for _, entry := range entries {
+		entriesByDate[entry.Date] = append(entriesByDate[entry.Date], entry)
+	}
+	return plannedByDate, entriesByDate, nil
+}
+
+func getPlan(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	dates, ok := planRange(c, &user)
+	if !ok {
+		return
+	}
+
+	plannedByDate, entriesByDate, err := loadPlanAndEntries(userID, dates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+
+	days := make([]models.PlanDay, len(dates))
+	for i, date := range dates {
+		planned := plannedByDate[date]
+		if planned == nil {
+			planned = []models.PlannedEntry{}
+		}
+		// Planned items are summed like entries, per meal and in total
+		asEntries := make([]models.FoodEntry, len(planned))
+		for j := range planned {
+			asEntries[j] = planned[j].ToFoodEntry()
+		}
+		days[i] = models.PlanDay{
+			Date:    date,
+			Planned: planned,
+			Meals:   models.MealTotalsFor(asEntries, user.Meals()),
+			Totals:  models.SumNutrition(asEntries),
+			Logged:  models.SumNutrition(entriesByDate[date]),
+		}
+	}
+
+	c.JSON(http.StatusOK, days)
+}
+
+func getPlanStats(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	dates, ok := planRange(c, &user)
+	if !ok {
+		return
+	}
+
+	plannedByDate, entriesByDate, err := loadPlanAndEntries(userID, dates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+
+	stats := make([]models.PlanDayStats, len(dates))
+	for i, date := range dates {
+		day := models.PlanDayStats{Date: date}
+		for _, item := range plannedByDate[date] {
+			day.PlannedCalories += item.Calories
+			day.PlannedItems++
+			if item.FoodEntryID != nil {
+				day.EatenCalories += item.Calories
+				day.EatenItems++
+			}
+		}
+		day.LoggedCalories = models.SumNutrition(entriesByDate[date]).Calories
+		day.Difference = day.LoggedCalories - day.PlannedCalories
+		stats[i] = day
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":           stats,
+		"neededCalories": user.CalculateNeededCalories(),
+	})
+}
+
+// generatePlan builds a meal plan meeting the user's calorie and macro
+// targets from the catalog, their favourites and their food sets
+func generatePlan(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req models.GeneratePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	start := user.Now().AddDate(0, 0, 1)
+	if req.Date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.Date, user.Location())
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
 			return
 		}
+		start = parsed
+	}
+	if req.Days == 0 {
+		req.Days = 1
+	}
+	meals := models.DefaultMeals
+	if len(req.Meals) > 0 {
+		meals = nil
+		for _, meal := range req.Meals {
+			meal = models.NormalizeMeal(meal)
+			if meal == "" || !user.HasMeal(meal) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown meal"})
+				return
+			}
+			if !slices.Contains(meals, meal) {
+				meals = append(meals, meal)
+			}
+		}
+	}
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
 	}
 
-	// Load the food set with full food data
-	var foodSet models.FoodSet
-	if err := config.DB.Where("id = ? AND user_id = ?", setID, userID).
-		Preload("Entries.Food").First(&foodSet).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+	// Candidate foods must suit the user's diet and the request's exclusions
+	var catalog []models.Food
+	if err := config.DB.Preload("Servings").Where("retired_at IS NULL").
+		Order("id").Find(&catalog).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+	allergens := append(append([]string{}, user.Allergens...), req.ExcludeAllergens...)
+	var foods []models.Food
+	for _, food := range catalog {
+		if models.PlannableFood(food) && food.MatchesDiet(user.DietaryPrefs, allergens) &&
+			!slices.Contains(req.ExcludeFoods, food.ID) {
+			foods = append(foods, food)
+		}
+	}
+	if len(foods) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No foods match the dietary preferences and exclusions"})
 		return
 	}
 
-	// Create new entries for the current date
-	var newEntries []models.FoodEntry
-	for _, entry := range foodSet.Entries {
-		// Find the serving size
-		var serving models.FoodServing
-		if err := config.DB.Where("food_id = ? AND description = ?", entry.FoodID, entry.ServingDesc).First(&serving).Error; err != nil {
-			log.Printf("Error loading serving data: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid serving size"})
+	favorites, err := favoriteFoodIDs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorite foods"})
+		return
+	}
+	var sets []models.FoodSet
+	if err := config.DB.Where("user_id = ?", userID).Order("id").
+		Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Entries.Food").Find(&sets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food sets"})
+		return
+	}
+
+	generator := models.NewPlanGenerator(seed, foods, favorites, sets)
+	generator.Targets = user.CalculateMacroTargets()
+	generator.Meals = meals
+	if req.Tolerance > 0 {
+		generator.Tolerance = req.Tolerance
+	}
+	if req.MaxRepeats > 0 {
+		generator.MaxRepeats = req.MaxRepeats
+	}
+
+	days := make([]models.GeneratedDay, req.Days)
+	for i := range days {
+		days[i] = generator.GenerateDay(start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+
+	if req.Save {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			for i := range days {
+				for j := range days[i].Items {
+					days[i].Items[j].UserID = userID
+					if err := tx.Omit("Food").Create(&days[i].Items[j]).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error saving generated meal plan: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save meal plan"})
 			return
 		}
+	}
 
-		// Calculate calories based on serving size and quantity
-		calories := float64(entry.Food.Calories) * serving.Grams * entry.Quantity / 100.0
+	c.JSON(http.StatusOK, gin.H{
+		"seed": seed,
+		"days": days,
+	})
+}
 
-		newEntry := models.FoodEntry{
-			UserID:       userID,
-			FoodID:      entry.FoodID,
-			ServingDesc:  entry.ServingDesc,
-			ServingGrams: serving.Grams,
-			Quantity:     entry.Quantity,
-			Date:        date,
-			Calories:    calories,
-			Food:        entry.Food,
+// getShoppingList adds up the planned items that were not eaten yet in a
+// date range (the current week by default) and the items of the food sets
+// given in sets, e.g. sets=3,5. A set listed twice is counted twice. The
+// list is returned as JSON, or as plain text or CSV with format=text|csv.
+func getShoppingList(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	dates, ok := planRange(c, &user)
+	if !ok {
+		return
+	}
+	from, to := dates[0], dates[len(dates)-1]
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "text" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json, text or csv"})
+		return
+	}
+
+	list := models.NewShoppingList()
+
+	var planned []models.PlannedEntry
+	if err := config.DB.Preload("Food.Servings").
+		Where("user_id = ? AND date BETWEEN ? AND ? AND food_entry_id IS NULL", userID, from, to).
+		Find(&planned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	for _, item := range planned {
+		list.Add(item.Food, item.ServingGrams*item.Quantity)
+	}
+
+	for _, setID := range splitList(c.Query("sets")) {
+		var foodSet models.FoodSet
+		if err := config.DB.Where("id = ? AND user_id = ?", setID, userID).
+			Preload("Entries.Food.Servings").First(&foodSet).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Food set " + setID + " not found"})
+			return
+		}
+		for _, item := range foodSet.Entries {
+			list.Add(item.Food, item.ServingGrams*item.Quantity)
 		}
-		newEntries = append(newEntries, newEntry)
 	}
 
-	// Save all new entries
-	if err := config.DB.Create(&newEntries).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create food entries"})
+	var checkedIDs []uint
+	if err := config.DB.Model(&models.ShoppingListCheck{}).
+		Where("user_id = ? AND list_key = ?", userID, models.ShoppingListKey(from, to)).
+		Pluck("food_id", &checkedIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shopping list"})
 		return
 	}
+	checked := make(map[uint]bool, len(checkedIDs))
+	for _, id := range checkedIDs {
+		checked[id] = true
+	}
 
-	c.JSON(http.StatusOK, newEntries)
+	categories := list.Categories(checked)
+	switch format {
+	case "text":
+		c.String(http.StatusOK, models.ShoppingListText("Shopping list "+from+" to "+to, categories))
+	case "csv":
+		c.Header("Content-Disposition", "attachment; filename=shopping-list-"+from+"-"+to+".csv")
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := models.WriteShoppingListCSV(c.Writer, categories); err != nil {
+			log.Printf("Error writing shopping list CSV: %v", err)
+		}
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"from":       from,
+			"to":         to,
+			"categories": categories,
+		})
+	}
 }
 
-func deleteFoodSet(c *gin.Context) {
+// checkShoppingItem checks a food off the list for a date range, or
+// unchecks it
+func checkShoppingItem(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	setID := c.Param("id")
+	var req models.ShoppingCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, date := range []string{req.From, req.To} {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+	if req.From > req.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
 
-	// First verify the food set belongs to the user
-	var foodSet models.FoodSet
-	if err := config.DB.Where("id = ? AND user_id = ?", setID, userID).First(&foodSet).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Food set not found"})
+	// Only foods planned in the range or in one of the user's sets can be
+	// on the list
+	if req.Checked {
+		var planned, inSets int64
+		config.DB.Model(&models.PlannedEntry{}).
+			Where("user_id = ? AND food_id = ? AND date BETWEEN ? AND ?", userID, req.FoodID, req.From, req.To).
+			Count(&planned)
+		config.DB.Model(&models.FoodSetItem{}).
+			Joins("JOIN food_sets ON food_sets.id = food_set_items.food_set_id AND food_sets.deleted_at IS NULL").
+			Where("food_sets.user_id = ? AND food_set_items.food_id = ?", userID, req.FoodID).
+			Count(&inSets)
+		if planned == 0 && inSets == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Food is not on the shopping list"})
+			return
+		}
+	}
+
+	check := models.ShoppingListCheck{
+		UserID:  userID,
+		ListKey: models.ShoppingListKey(req.From, req.To),
+		FoodID:  req.FoodID,
+	}
+	var err error
+	if req.Checked {
+		err = config.DB.Where(&check).FirstOrCreate(&check).Error
+	} else {
+		err = config.DB.Where(&check).Delete(&models.ShoppingListCheck{}).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shopping list"})
 		return
 	}
 
-	// Delete the food set (this will automatically delete associated entries due to GORM's cascading delete)
-	if err := config.DB.Delete(&foodSet).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food set"})
+	c.JSON(http.StatusOK, gin.H{"food_id": req.FoodID, "checked": req.Checked})
+}
+
+// materializeRecurringEntry logs the entries of a rule for every day it
+// occurred since it last ran, up to today in the user's time zone, and
+// returns how many entries were created
+func materializeRecurringEntry(db *gorm.DB, user *models.User, rule *models.RecurringEntry) (int, error) {
+	today := user.Today()
+	if rule.LastDate >= today {
+		return 0, nil
+	}
+	dates := rule.PendingDates(today)
+
+	// The entries to log each day, either the food or the set's items
+	var templates []models.FoodEntry
+	if rule.FoodSetID != nil {
+		var foodSet models.FoodSet
+		if err := loadFoodSet(db, rule.UserID, strconv.FormatUint(uint64(*rule.FoodSetID), 10), &foodSet); err != nil {
+			return 0, err
+		}
+		for _, item := range foodSet.Entries {
+			templates = append(templates, models.FoodEntry{FoodID: item.FoodID, ServingDesc: item.ServingDesc, Quantity: item.Quantity})
+		}
+	} else {
+		templates = append(templates, models.FoodEntry{FoodID: *rule.FoodID, ServingDesc: rule.ServingDesc, Quantity: rule.Quantity})
+	}
+
+	var entries []models.FoodEntry
+	for _, date := range dates {
+		for _, template := range templates {
+			entry := template
+			entry.UserID = rule.UserID
+			entry.Date = date.Format("2006-01-02")
+			entry.Meal = rule.Meal
+			entry.Time = rule.Time
+			entry.RecurringID = &rule.ID
+			// Skip foods that were retired or lost their serving since
+			if err := prepareFoodEntry(db, user, &entry); err != nil {
+				log.Printf("Skipping recurring entry %d on %s: %v", rule.ID, entry.Date, err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	created := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Claim the dates, a concurrent run that got here first has logged
+		// them already
+		result := tx.Model(&models.RecurringEntry{}).
+			Where("id = ? AND last_date = ?", rule.ID, rule.LastDate).
+			Update("last_date", today)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if len(entries) > 0 {
+			if err := tx.Omit("Food").CreateInBatches(&entries, 100).Error; err != nil {
+				return err
+			}
+		}
+		created = len(entries)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	rule.LastDate = today
+	return created, nil
+}
+
+// materializeAllRecurringEntries runs every rule that has not ended yet
+func materializeAllRecurringEntries() {
+	var rules []models.RecurringEntry
+	if err := config.DB.Where("end_date = '' OR last_date = '' OR last_date < end_date").Order("user_id, id").Find(&rules).Error; err != nil {
+		log.Printf("Failed to load recurring entries: %v", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Food set deleted successfully"})
+	var user models.User
+	for i := range rules {
+		if user.ID != rules[i].UserID {
+			user = models.User{}
+			if err := config.DB.First(&user, rules[i].UserID).Error; err != nil {
+				log.Printf("Failed to load user %d for recurring entries: %v", rules[i].UserID, err)
+				continue
+			}
+		}
+		created, err := materializeRecurringEntry(config.DB, &user, &rules[i])
+		if err != nil {
+			log.Printf("Failed to log recurring entry %d: %v", rules[i].ID, err)
+		} else if created > 0 {
+			log.Printf("Logged %d entries for recurring entry %d", created, rules[i].ID)
+		}
+	}
 }
 
-func getWeeklyStats(c *gin.Context) {
+// startRecurringEntries logs recurring entries now and then every 15
+// minutes, so each rule runs soon after midnight in its user's time zone
+func startRecurringEntries() {
+	materializeAllRecurringEntries()
+	go func() {
+		for range time.Tick(15 * time.Minute) {
+			materializeAllRecurringEntries()
+		}
+	}()
+}
+
+func getRecurringEntries(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	startDate := c.Query("startDate")
-	endDate := c.Query("endDate")
 
-	if startDate == "" || endDate == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Start date and end date are required"})
+	var rules []models.RecurringEntry
+	if err := config.DB.Where("user_id = ?", userID).Order("id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring entries"})
 		return
 	}
 
-	var foodEntries []models.FoodEntry
-	if err := config.DB.Where("user_id = ? AND date BETWEEN ? AND ?", userID, startDate, endDate).
-		Find(&foodEntries).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food entries"})
+	c.JSON(http.StatusOK, rules)
+}
+
+// createRecurringEntry adds a rule and logs its entries up to today
+func createRecurringEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var rule models.RecurringEntry
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = 0
+	rule.UserID = userID
+	rule.SkipDates = nil
+	rule.LastDate = ""
+	rule.Meal = models.NormalizeMeal(rule.Meal)
+	if rule.StartDate == "" {
+		rule.StartDate = user.Today()
+	}
+	if err := rule.Validate(user.Today()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !user.HasMeal(rule.Meal) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown meal"})
+		return
+	}
+	if rule.Time != "" && !models.ValidTimeOfDay(rule.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format. Use HH:MM"})
+		return
+	}
+
+	if rule.FoodSetID != nil {
+		var foodSet models.FoodSet
+		if err := config.DB.Where("id = ? AND user_id = ?", *rule.FoodSetID, userID).First(&foodSet).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Food set not found"})
+			return
+		}
+	} else {
+		// Check the food and serving the same way a logged entry would be
+		entry := models.FoodEntry{FoodID: *rule.FoodID, ServingDesc: rule.ServingDesc, Quantity: rule.Quantity, Date: rule.StartDate}
+		if err := prepareFoodEntry(config.DB, &user, &entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Create the rule and log its entries up to today together
+	var created int
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		var err error
+		created, err = materializeRecurringEntry(tx, &user, &rule)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error creating recurring entry for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recurring entry"})
 		return
 	}
 
-	// Get user's needed calories
+	c.JSON(http.StatusCreated, gin.H{"recurring_entry": rule, "created": created})
+}
+
+// loadRecurringRequest loads the user's rule from the path and the date
+// from the body, which defaults to today
+func loadRecurringRequest(c *gin.Context, rule *models.RecurringEntry) (string, bool) {
+	userID := c.GetUint("user_id")
+
 	var user models.User
 	if err := config.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user data"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return "", false
+	}
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurring entry not found"})
+		return "", false
+	}
+
+	var req models.RecurringDateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if req.Date == "" {
+		return user.Today(), true
+	}
+	if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return "", false
+	}
+	return req.Date, true
+}
+
+// skipRecurringEntry skips one occurrence of a rule and removes the entries
+// it already logged that day
+func skipRecurringEntry(c *gin.Context) {
+	var rule models.RecurringEntry
+	date, ok := loadRecurringRequest(c, &rule)
+	if !ok {
+		return
+	}
+	day, _ := time.Parse("2006-01-02", date)
+	if !rule.Occurs(day) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Recurring entry does not occur on " + date})
 		return
 	}
 
-	// Calculate total calories consumed
-	totalCalories := 0.0
-	for _, entry := range foodEntries {
-		totalCalories += entry.Calories
+	var removed int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if !slices.Contains(rule.SkipDates, date) {
+			rule.SkipDates = append(rule.SkipDates, date)
+			if err := tx.Model(&rule).Update("skip_dates", rule.SkipDates).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Where("recurring_id = ? AND date = ?", rule.ID, date).Delete(&models.FoodEntry{})
+		removed = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to skip recurring entry"})
+		return
 	}
 
-	// Calculate weekly calorie goal (daily goal * 7 days)
-	weeklyCalorieGoal := float64(user.CalculateNeededCalories() * 7)
+	c.JSON(http.StatusOK, gin.H{"recurring_entry": rule, "removed": removed})
+}
 
-	// Calculate the weekly achievement percentage
-	weeklyPercentage := (totalCalories / weeklyCalorieGoal) * 100
+// endRecurringEntry ends a rule after the given date and removes the
+// entries it logged later than that
+func endRecurringEntry(c *gin.Context) {
+	var rule models.RecurringEntry
+	date, ok := loadRecurringRequest(c, &rule)
+	if !ok {
+		return
+	}
+	if date < rule.StartDate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end date must not be before start_date"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"totalCalories":     totalCalories,
-		"averagePercentage": weeklyPercentage,
+	var removed int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		rule.EndDate = date
+		if err := tx.Model(&rule).Update("end_date", date).Error; err != nil {
+			return err
+		}
+		result := tx.Where("recurring_id = ? AND date > ?", rule.ID, date).Delete(&models.FoodEntry{})
+		removed = result.RowsAffected
+		return result.Error
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end recurring entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recurring_entry": rule, "removed": removed})
+}
+
+// deleteRecurringEntry removes a rule. Entries it already logged are kept.
+func deleteRecurringEntry(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	result := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.RecurringEntry{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring entry"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurring entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring entry deleted successfully"})
 }
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"caloricsAPI/config"
+	"caloricsAPI/models"
 	"fmt"
 	"net/http"
 	"strings"
@@ -67,3 +69,17 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 	}
 }
+
+// AdminMiddleware only lets through users flagged as admins.
+// It must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		if err := config.DB.First(&user, c.GetUint("user_id")).Error; err != nil || !user.IsAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
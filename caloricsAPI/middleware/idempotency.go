@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"caloricsAPI/config"
+	"caloricsAPI/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a stored response is replayed for retries with the same key
+const idempotencyWindow = 24 * time.Hour
+
+// responseRecorder keeps a copy of the response body while writing it
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware honours the Idempotency-Key header. The first
+// response per user and key is stored and replayed for retries within
+// idempotencyWindow; reusing a key for a different request is a conflict.
+// Requests without the header are handled as usual. It must run after
+// AuthMiddleware.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+		userID := c.GetUint("user_id")
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.RequestURI()+"\n"), body...))
+		requestHash := hex.EncodeToString(hash[:])
+
+		// Forget the user's expired keys so they can be used again
+		cutoff := time.Now().Add(-idempotencyWindow)
+		if err := config.DB.Where("user_id = ? AND created_at < ?", userID, cutoff).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			log.Printf("Error removing expired idempotency keys: %v", err)
+		}
+
+		record := models.IdempotencyKey{UserID: userID, Key: key, RequestHash: requestHash}
+		if err := config.DB.Create(&record).Error; err != nil {
+			// The key was used before, replay its response
+			var existing models.IdempotencyKey
+			if err := config.DB.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+				log.Printf("Error storing idempotency key: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process Idempotency-Key"})
+				c.Abort()
+				return
+			}
+			switch {
+			case existing.RequestHash != requestHash:
+				c.JSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case existing.StatusCode == 0:
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		// A panicking handler must not leave the key in progress, or every
+		// retry would be rejected until the key expires
+		defer func() {
+			if r := recover(); r != nil {
+				config.DB.Delete(&record)
+				panic(r)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not stored so the request can be retried
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			config.DB.Delete(&record)
+			return
+		}
+		if err := config.DB.Model(&record).Updates(models.IdempotencyKey{
+			StatusCode: status,
+			Body:       recorder.body.Bytes(),
+		}).Error; err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WeightLog is the weight a user had on a day, recorded when the profile
+// weight changes. A day keeps only its last weight.
+type WeightLog struct {
+	gorm.Model
+	UserID uint   `json:"user_id" gorm:"uniqueIndex:idx_weight_user_date"`
+	Date   string `json:"date" gorm:"uniqueIndex:idx_weight_user_date"`
+	Weight int    `json:"weight"`
+}
+
+// AnalyticsBuckets maps each bucket size to the longest range in days it
+// can be requested for
+var AnalyticsBuckets = map[string]int{
+	"day":   366,
+	"week":  2 * 366,
+	"month": 5 * 366,
+}
+
+// AnalyticsRow is one bucket of totals aggregated in SQL
+type AnalyticsRow struct {
+	Bucket        string
+	Calories      float64
+	Protein       float64
+	Carbohydrates float64
+	Fat           float64
+	Entries       int
+	DaysLogged    int
+}
+
+// WeightRow is the average weight logged in one bucket
+type WeightRow struct {
+	Bucket string
+	Weight float64
+}
+
+// AnalyticsPoint is one bucket of the analytics series. Buckets without
+// entries have zero totals and buckets without a weight have none.
+type AnalyticsPoint struct {
+	Start           string   `json:"start"`
+	End             string   `json:"end"`
+	Calories        float64  `json:"calories"`
+	Protein         float64  `json:"protein"`
+	Carbohydrates   float64  `json:"carbohydrates"`
+	Fat             float64  `json:"fat"`
+	Entries         int      `json:"entries"`
+	DaysLogged      int      `json:"daysLogged"`
+	AverageCalories float64  `json:"averageCalories"` // Per logged day
+	Weight          *float64 `json:"weight"`
+}
+
+// BucketSQL returns the SQL expression mapping a YYYY-MM-DD date column to
+// the first day of its bucket. Weeks start on Monday.
+func BucketSQL(bucket, column string) string {
+	switch bucket {
+	case "week":
+		return fmt.Sprintf("date(%s, '-' || ((CAST(strftime('%%w', %s) AS INTEGER) + 6) %% 7) || ' days')", column, column)
+	case "month":
+		return fmt.Sprintf("strftime('%%Y-%%m-01', %s)", column)
+	}
+	return column
+}
+
+// BucketStart returns the first day of the bucket the date falls in
+func BucketStart(bucket string, date time.Time) time.Time {
+	switch bucket {
+	case "week":
+		start, _ := WeekOf(date)
+		parsed, _ := time.Parse("2006-01-02", start)
+		return parsed
+	case "month":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+// nextBucket returns the first day of the bucket after the one starting at
+// start
+func nextBucket(bucket string, start time.Time) time.Time {
+	switch bucket {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// AnalyticsRange checks the bucket and range of an analytics request
+func AnalyticsRange(bucket, from, to string) error {
+	maxDays, ok := AnalyticsBuckets[bucket]
+	if !ok {
+		return errors.New("Bucket must be day, week or month")
+	}
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return errors.New("Invalid from date format. Use YYYY-MM-DD")
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return errors.New("Invalid to date format. Use YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("to must not be before from")
+	}
+	if end.Sub(start) >= time.Duration(maxDays)*24*time.Hour {
+		return fmt.Errorf("Range can't be longer than %d days for %s buckets", maxDays, bucket)
+	}
+	return nil
+}
+
+// AnalyticsSeries returns a point for every bucket from from to to, filled
+// in with the aggregated rows. The first and last buckets are cut to the
+// range.
+func AnalyticsSeries(bucket, from, to string, rows []AnalyticsRow, weights []WeightRow) []AnalyticsPoint {
+	byBucket := make(map[string]AnalyticsRow)
+	for _, row := range rows {
+		byBucket[row.Bucket] = row
+	}
+	weightByBucket := make(map[string]float64)
+	for _, row := range weights {
+		weightByBucket[row.Bucket] = row.Weight
+	}
+
+	start, _ := time.Parse("2006-01-02", from)
+	end, _ := time.Parse("2006-01-02", to)
+	var points []AnalyticsPoint
+	for bucketStart := BucketStart(bucket, start); !bucketStart.After(end); bucketStart = nextBucket(bucket, bucketStart) {
+		key := bucketStart.Format("2006-01-02")
+		point := AnalyticsPoint{Start: key, End: nextBucket(bucket, bucketStart).AddDate(0, 0, -1).Format("2006-01-02")}
+		if bucketStart.Before(start) {
+			point.Start = from
+		}
+		if point.End > to {
+			point.End = to
+		}
+
+		if row, ok := byBucket[key]; ok {
+			point.Calories = row.Calories
+			point.Protein = row.Protein
+			point.Carbohydrates = row.Carbohydrates
+			point.Fat = row.Fat
+			point.Entries = row.Entries
+			point.DaysLogged = row.DaysLogged
+			if row.DaysLogged > 0 {
+				point.AverageCalories = row.Calories / float64(row.DaysLogged)
+			}
+		}
+		if weight, ok := weightByBucket[key]; ok {
+			point.Weight = &weight
+		}
+		points = append(points, point)
+	}
+	return points
+}
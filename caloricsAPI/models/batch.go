@@ -0,0 +1,23 @@
+package models
+
+type BatchEntryUpdate struct {
+	ID uint `json:"id" binding:"required"`
+	FoodEntryUpdate
+}
+
+// FoodEntryBatch is a set of entry changes applied in one transaction,
+// with at most 100 items per operation
+type FoodEntryBatch struct {
+	Create []FoodEntry        `json:"create" binding:"max=100,dive"`
+	Update []BatchEntryUpdate `json:"update" binding:"max=100,dive"`
+	Delete []uint             `json:"delete" binding:"max=100"`
+}
+
+// BatchItemResult reports the outcome of one item of a batch
+type BatchItemResult struct {
+	Operation string     `json:"operation"`
+	Index     int        `json:"index"`
+	ID        uint       `json:"id,omitempty"`
+	Entry     *FoodEntry `json:"entry,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// CopyEntriesRequest copies the entries of one date, or of one meal on that
+// date, to other dates
+type CopyEntriesRequest struct {
+	FromDate     string   `json:"from_date" binding:"required"`
+	Meal         string   `json:"meal"` // Only copy this meal, all meals when empty
+	ToDates      []string `json:"to_dates" binding:"required,min=1,max=31"`
+	ToMeal       *string  `json:"to_meal"`       // Log the copies to this meal instead of their own
+	SkipExisting bool     `json:"skip_existing"` // Skip items already logged on the target date
+}
+
+// SameItem reports whether two entries log the same food, serving and meal
+func (e *FoodEntry) SameItem(other FoodEntry) bool {
+	return e.FoodID == other.FoodID && e.ServingDesc == other.ServingDesc && e.Meal == other.Meal
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Dietary tags that can be set on foods and chosen as user preferences
+var DietaryTags = []string{"vegan", "vegetarian", "gluten-free", "lactose-free", "halal", "kosher"}
+
+// The 14 major allergens that must be declared on food labels
+var Allergens = []string{
+	"celery", "gluten", "crustaceans", "eggs", "fish", "lupin", "milk",
+	"molluscs", "mustard", "nuts", "peanuts", "sesame", "soybeans", "sulphites",
+}
+
+var allergenKeywords = map[string][]string{
+	"celery":      {"celery", "celeriac"},
+	"gluten":      {"bread", "wheat", "pasta", "spaghetti", "macaroni", "lasagna", "noodle", "bagel", "bun", "biscuit", "cracker", "barley", "rye", "bulgur", "couscous", "flour", "bran", "pizza", "cake", "cookie", "brownie", "muffin", "pancake", "waffle", "pastry", "pie", "donut", "doughnut", "croissant", "beer", "breadstick", "crumb", "burrito", "calzone", "pretzel", "toast", "tortilla", "seitan", "egg roll", "dumpling", "cereal", "granola", "stuffing", "tortellini", "ravioli", "naan", "orzo", "pita", "cobbler", "dough", "tabouli", "tabbouleh", "muesli"},
+	"crustaceans": {"shrimp", "prawn", "crab", "lobster", "crayfish"},
+	"eggs":        {"egg", "mayonnaise", "mayo", "omelet", "omelette", "eggnog", "custard", "meringue", "quiche", "cake", "cookie", "brownie", "muffin", "pancake", "waffle", "pastry", "donut", "doughnut", "croissant"},
+	"fish":        {"fish", "seafood", "salmon", "tuna", "cod", "trout", "anchovy", "sardine", "carp", "catfish", "char", "halibut", "tilapia", "mackerel", "herring", "bass", "snapper", "sushi", "caviar", "haddock", "pollock", "swordfish", "flounder", "sole", "perch", "pike", "eel"},
+	"lupin":       {"lupin", "lupine"},
+	"milk":        {"cheese", "yogurt", "yoghurt", "whey", "buttermilk", "custard", "pudding", "latte", "cappuccino", "milkshake", "kefir", "ghee", "brie", "mozzarella", "cheddar", "parmesan", "ricotta", "feta", "camembert", "gouda", "eggnog", "pizza", "lasagna", "alfredo", "cheesecake", "ice cream", "cream cheese", "sour cream", "frosting", "sundae"},
+	"molluscs":    {"oyster", "clam", "mussel", "scallop", "squid", "calamari", "octopus", "snail", "escargot"},
+	"mustard":     {"mustard"},
+	"nuts":        {"almond", "walnut", "cashew", "pecan", "pistachio", "hazelnut", "brazil nut", "macadamia", "pine nut", "nut", "pesto", "praline", "marzipan", "nutella"},
+	"peanuts":     {"peanut"},
+	"sesame":      {"sesame", "tahini", "hummus"},
+	"soybeans":    {"soy", "soya", "tofu", "edamame", "tempeh", "miso"},
+	"sulphites":   {"wine", "raisin", "vinegar", "prune"},
+}
+
+var (
+	meatKeywords    = []string{"beef", "pork", "bacon", "ham", "sausage", "chicken", "turkey", "lamb", "veal", "bison", "venison", "duck", "goose", "salami", "pepperoni", "bologna", "hot dog", "burger", "hamburger", "brisket", "steak", "meatball", "meat", "jerky", "rib", "prosciutto", "gelatin", "lard", "mutton", "goat", "rabbit", "liver", "meatloaf", "pastrami", "wing", "nugget"}
+	porkKeywords    = []string{"pork", "bacon", "ham", "sausage", "salami", "pepperoni", "prosciutto", "lard", "bologna", "hot dog", "pastrami"}
+	alcoholKeywords = []string{"beer", "wine", "vodka", "whiskey", "whisky", "rum", "gin", "alcohol", "liquor", "champagne", "cocktail", "margarita", "martini", "sake", "brandy", "tequila", "cider"}
+	meatSubstitutes = []string{"soy", "veggie", "vegetarian", "vegan", "tofu", "plant", "seitan"}
+	dairyAmbiguous  = []string{"milk", "butter", "cream"}
+	dairySubstitute = []string{"soy", "almond", "coconut", "rice", "oat", "peanut", "cashew", "cocoa", "apple", "vegan"}
+	nonKosherFish   = []string{"catfish", "eel", "shark", "swordfish"}
+)
+
+// InferDietaryInfo makes a best guess at the dietary tags and allergens of a
+// food from its name. Allergens found in the name are facts, but tags only
+// mean no keyword contradicted them, so they are kept apart from curated
+// tags and never used for filtering.
+func InferDietaryInfo(name string) (tags []string, allergens []string) {
+	tokens := normalizeFoodName(name)
+	joined := " " + strings.Join(tokens, " ") + " "
+	meatFree := matchesAny(tokens, joined, meatSubstitutes)
+
+	for allergen, keywords := range allergenKeywords {
+		if matchesAny(tokens, joined, keywords) {
+			allergens = append(allergens, allergen)
+		}
+	}
+	// "milk" or "butter" alone is dairy, "almond milk" or "peanut butter" is not
+	if matchesAny(tokens, joined, dairyAmbiguous) && !matchesAny(tokens, joined, dairySubstitute) && !slices.Contains(allergens, "milk") {
+		allergens = append(allergens, "milk")
+	}
+	sort.Strings(allergens)
+
+	hasMeat := !meatFree && matchesAny(tokens, joined, meatKeywords)
+	hasPork := !meatFree && matchesAny(tokens, joined, porkKeywords)
+	hasAlcohol := matchesAny(tokens, joined, alcoholKeywords)
+	hasSeafood := slices.Contains(allergens, "fish") || slices.Contains(allergens, "crustaceans") || slices.Contains(allergens, "molluscs")
+	hasShellfish := slices.Contains(allergens, "crustaceans") || slices.Contains(allergens, "molluscs")
+	honey := matchesAny(tokens, joined, []string{"honey"})
+
+	vegetarian := !hasMeat && !hasSeafood
+	if vegetarian {
+		tags = append(tags, "vegetarian")
+		if !slices.Contains(allergens, "milk") && !slices.Contains(allergens, "eggs") && !honey {
+			tags = append(tags, "vegan")
+		}
+	}
+	if !slices.Contains(allergens, "gluten") {
+		tags = append(tags, "gluten-free")
+	}
+	if !slices.Contains(allergens, "milk") {
+		tags = append(tags, "lactose-free")
+	}
+	// Meat needs certified slaughter, so only meat-free foods are tagged
+	if !hasMeat && !hasPork && !hasAlcohol {
+		tags = append(tags, "halal")
+	}
+	if !hasMeat && !hasPork && !hasShellfish && !matchesAny(tokens, joined, nonKosherFish) {
+		tags = append(tags, "kosher")
+	}
+	sort.Strings(tags)
+
+	return tags, allergens
+}
+
+type FoodDietaryRequest struct {
+	Tags      []string `json:"tags" binding:"omitempty,dive,oneof=vegan vegetarian gluten-free lactose-free halal kosher"`
+	Allergens []string `json:"allergens" binding:"omitempty,dive,oneof=celery gluten crustaceans eggs fish lupin milk molluscs mustard nuts peanuts sesame soybeans sulphites"`
+}
+
+// MatchesDiet reports whether the food has all the given tags and none of
+// the given allergens
+func (f *Food) MatchesDiet(tags []string, allergens []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(f.Tags, tag) {
+			return false
+		}
+	}
+	for _, allergen := range allergens {
+		if slices.Contains(f.Allergens, allergen) {
+			return false
+		}
+	}
+	return true
+}
+
+// DietaryConflicts returns warnings for a food that contains one of the
+// user's allergens or lacks a tag the user's diet requires
+func (u *User) DietaryConflicts(food Food) []string {
+	var warnings []string
+	for _, allergen := range u.Allergens {
+		if slices.Contains(food.Allergens, allergen) {
+			warnings = append(warnings, food.Name+" contains "+allergen)
+		}
+	}
+	for _, preference := range u.DietaryPrefs {
+		if !slices.Contains(food.Tags, preference) {
+			warnings = append(warnings, food.Name+" is not marked "+preference)
+		}
+	}
+	return warnings
+}
+
+func matchesAny(tokens []string, joined string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(keyword, " ") {
+			if strings.Contains(joined, " "+keyword+" ") {
+				return true
+			}
+			continue
+		}
+		if slices.Contains(tokens, keyword) {
+			return true
+		}
+	}
+	return false
+}
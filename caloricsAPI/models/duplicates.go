@@ -0,0 +1,169 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type DuplicateCandidate struct {
+	Food          Food    `json:"food"`
+	Duplicate     Food    `json:"duplicate"`
+	Score         float64 `json:"score"`
+	NameScore     float64 `json:"name_score"`
+	NutrientScore float64 `json:"nutrient_score"`
+}
+
+type MergeFoodsRequest struct {
+	SurvivorID   uint   `json:"survivor_id" binding:"required"`
+	DuplicateIDs []uint `json:"duplicate_ids" binding:"required,min=1"`
+}
+
+// FindDuplicateCandidates scores every pair of foods and returns the pairs
+// scoring at least threshold, best matches first
+func FindDuplicateCandidates(foods []Food, threshold float64) []DuplicateCandidate {
+	normalized := make([][]string, len(foods))
+	for i, food := range foods {
+		normalized[i] = normalizeFoodName(food.Name)
+	}
+
+	var candidates []DuplicateCandidate
+	for i := 0; i < len(foods); i++ {
+		for j := i + 1; j < len(foods); j++ {
+			nameScore := nameSimilarity(normalized[i], normalized[j])
+			// Nutrients alone are not enough to call two foods duplicates
+			if nameScore < 0.5 {
+				continue
+			}
+			nutrientScore := NutrientSimilarity(foods[i], foods[j])
+			score := 0.6*nameScore + 0.4*nutrientScore
+			if score < threshold {
+				continue
+			}
+			candidates = append(candidates, DuplicateCandidate{
+				Food:          foods[i],
+				Duplicate:     foods[j],
+				Score:         roundTo(score, 3),
+				NameScore:     roundTo(nameScore, 3),
+				NutrientScore: roundTo(nutrientScore, 3),
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Score > candidates[b].Score
+	})
+	return candidates
+}
+
+// NameSimilarity compares two food names after normalizing case,
+// punctuation and plural forms. It returns a value between 0 and 1.
+func NameSimilarity(a, b string) float64 {
+	return nameSimilarity(normalizeFoodName(a), normalizeFoodName(b))
+}
+
+func nameSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	// Token overlap catches reordered or extra words ("egg yolks" vs "eggs")
+	tokens := make(map[string]bool)
+	for _, token := range a {
+		tokens[token] = true
+	}
+	shared := 0
+	union := len(tokens)
+	seen := make(map[string]bool)
+	for _, token := range b {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		if tokens[token] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	jaccard := float64(shared) / float64(union)
+
+	// Edit distance catches spelling variants ("yoghurt" vs "yogurt")
+	joinedA := strings.Join(a, " ")
+	joinedB := strings.Join(b, " ")
+	longest := math.Max(float64(len(joinedA)), float64(len(joinedB)))
+	editRatio := 1 - float64(levenshtein(joinedA, joinedB))/longest
+
+	return math.Max(jaccard, editRatio)
+}
+
+// NutrientSimilarity compares the per 100g values of two foods.
+// It returns 1 for identical values and approaches 0 as they diverge.
+func NutrientSimilarity(a, b Food) float64 {
+	distance := relativeDistance(float64(a.Calories), float64(b.Calories), 10) +
+		relativeDistance(a.Protein, b.Protein, 1) +
+		relativeDistance(a.Carbohydrates, b.Carbohydrates, 1) +
+		relativeDistance(a.Fat, b.Fat, 1)
+	return 1 - distance/4
+}
+
+func relativeDistance(a, b, floor float64) float64 {
+	return math.Abs(a-b) / math.Max(math.Max(a, b), floor)
+}
+
+func normalizeFoodName(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, field := range fields {
+		fields[i] = singularize(field)
+	}
+	return fields
+}
+
+func singularize(word string) string {
+	switch {
+	case len(word) <= 3:
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
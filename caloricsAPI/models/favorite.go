@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// FavoriteFood marks a food as a favorite of a user. Favorites are removed
+// with a hard delete, so a user has at most one row per food.
+type FavoriteFood struct {
+	gorm.Model
+	UserID uint `json:"user_id" gorm:"uniqueIndex:idx_favorite_user_food"`
+	FoodID uint `json:"food_id" gorm:"uniqueIndex:idx_favorite_user_food"`
+	Food   Food `json:"food" gorm:"foreignKey:FoodID"`
+}
+
+// RecentFood is a food the user logged before, with the serving and
+// quantity of the last time it was logged
+type RecentFood struct {
+	Food         Food    `json:"food"`
+	ServingDesc  string  `json:"serving_desc"`
+	ServingGrams float64 `json:"serving_grams"`
+	Quantity     float64 `json:"quantity"`
+	Calories     float64 `json:"calories"`
+	LastUsed     string  `json:"last_used"`
+	TimesLogged  int     `json:"times_logged"`
+	Favorite     bool    `json:"favorite"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// FoodSetUpdate holds the fields of a set that can be changed, nil fields
+// are left as they are. Entries replaces all items of the set.
+type FoodSetUpdate struct {
+	Name        *string        `json:"name" binding:"omitempty,min=1"`
+	Description *string        `json:"description"`
+	Entries     *[]FoodSetItem `json:"entries" binding:"omitempty,dive"`
+}
+
+// FoodSetItemUpdate holds the fields of a set item that can be changed
+type FoodSetItemUpdate struct {
+	ServingDesc *string  `json:"serving_desc" binding:"omitempty,min=1"`
+	Quantity    *float64 `json:"quantity" binding:"omitempty,gt=0"`
+}
+
+// Apply copies the set fields onto the item
+func (u *FoodSetItemUpdate) Apply(item *FoodSetItem) {
+	if u.ServingDesc != nil {
+		item.ServingDesc = *u.ServingDesc
+	}
+	if u.Quantity != nil {
+		item.Quantity = *u.Quantity
+	}
+}
+
+// ScaleQuantity multiplies a quantity by factor, rounded to two decimals
+func ScaleQuantity(quantity, factor float64) float64 {
+	return roundTo(quantity*factor, 2)
+}
@@ -0,0 +1,391 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+type GeneratePlanRequest struct {
+	Date             string   `json:"date"`                                       // First day, tomorrow by default
+	Days             int      `json:"days" binding:"omitempty,min=1,max=7"`       // 1 by default
+	Seed             *int64   `json:"seed"`                                       // Same seed and data give the same plan
+	Tolerance        float64  `json:"tolerance" binding:"omitempty,gt=0,max=0.5"` // Allowed deviation from the targets, 0.1 by default
+	Meals            []string `json:"meals"`                                      // Meals to plan, the default meals when empty
+	ExcludeFoods     []uint   `json:"exclude_foods" binding:"max=200"`            // Foods never to pick
+	ExcludeAllergens []string `json:"exclude_allergens" binding:"omitempty,dive,oneof=celery gluten crustaceans eggs fish lupin milk molluscs mustard nuts peanuts sesame soybeans sulphites"`
+	MaxRepeats       int      `json:"max_repeats" binding:"omitempty,min=1"` // Times a food may appear in the plan, 2 by default
+	Save             bool     `json:"save"`                                  // Store the plan as planned entries
+}
+
+// GeneratedDay is one day of a generated meal plan
+type GeneratedDay struct {
+	Date            string         `json:"date"`
+	Items           []PlannedEntry `json:"items"`
+	Totals          Nutrition      `json:"totals"`
+	Targets         Nutrition      `json:"targets"`
+	WithinTolerance bool           `json:"within_tolerance"`
+}
+
+// Share of the day's calories per meal. Custom meals get customMealShare.
+var mealShares = map[string]float64{"breakfast": 0.25, "lunch": 0.35, "dinner": 0.30, "snacks": 0.10}
+
+const (
+	customMealShare = 0.15
+	attemptsPerDay  = 25
+	minItemGrams    = 20
+	maxItemGrams    = 400
+)
+
+// PlanGenerator picks foods and portions for days of a meal plan. Foods
+// must have their servings loaded and sets their items and foods. All
+// randomness comes from the seed, so the same input gives the same plan.
+type PlanGenerator struct {
+	Foods      []Food
+	Favorites  map[uint]bool
+	Sets       []FoodSet
+	Targets    Nutrition
+	Meals      []string
+	Tolerance  float64
+	MaxRepeats int
+
+	rng     *rand.Rand
+	used    map[uint]int
+	allowed map[uint]bool
+}
+
+func NewPlanGenerator(seed int64, foods []Food, favorites map[uint]bool, sets []FoodSet) *PlanGenerator {
+	sort.SliceStable(foods, func(a, b int) bool { return foods[a].ID < foods[b].ID })
+	allowed := make(map[uint]bool, len(foods))
+	for _, food := range foods {
+		allowed[food.ID] = true
+	}
+	return &PlanGenerator{
+		Foods:      foods,
+		Favorites:  favorites,
+		Sets:       sets,
+		Meals:      DefaultMeals,
+		Tolerance:  0.1,
+		MaxRepeats: 2,
+		rng:        rand.New(rand.NewSource(seed)),
+		used:       make(map[uint]int),
+		allowed:    allowed,
+	}
+}
+
+// PlannableFood reports whether a food can be picked as a main item, which
+// excludes foods without calories, alcohol and condiments measured by the
+// spoon
+func PlannableFood(food Food) bool {
+	if food.Calories <= 0 || gramServing(food.Servings) == nil {
+		return false
+	}
+	tokens := normalizeFoodName(food.Name)
+	if matchesAny(tokens, " "+strings.Join(tokens, " ")+" ", alcoholKeywords) {
+		return false
+	}
+	for _, serving := range food.Servings {
+		for _, token := range normalizeFoodName(serving.Description) {
+			if token == "teaspoon" || token == "tablespoon" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GenerateDay plans one day. It tries several combinations and keeps the
+// one closest to the targets, stopping early when one is within tolerance.
+func (g *PlanGenerator) GenerateDay(date string) GeneratedDay {
+	var best []PlannedEntry
+	bestScore := math.Inf(1)
+	for attempt := 0; attempt < attemptsPerDay; attempt++ {
+		items := g.pickDay(date)
+		if len(items) == 0 {
+			continue
+		}
+		g.adjustPortions(items)
+		score := g.score(sumPlanned(items))
+		if score < bestScore {
+			best, bestScore = items, score
+		}
+		if g.withinTolerance(sumPlanned(best)) {
+			break
+		}
+	}
+
+	for _, item := range best {
+		g.used[item.FoodID]++
+	}
+	if best == nil {
+		best = []PlannedEntry{}
+	}
+	totals := sumPlanned(best)
+	return GeneratedDay{
+		Date:            date,
+		Items:           best,
+		Totals:          roundNutrition(totals),
+		Targets:         g.Targets,
+		WithinTolerance: len(best) > 0 && g.withinTolerance(totals),
+	}
+}
+
+func (g *PlanGenerator) pickDay(date string) []PlannedEntry {
+	shares := make([]float64, len(g.Meals))
+	var total float64
+	for i, meal := range g.Meals {
+		share, ok := mealShares[meal]
+		if !ok {
+			share = customMealShare
+		}
+		shares[i] = share
+		total += share
+	}
+
+	var items []PlannedEntry
+	inDay := make(map[uint]bool)
+	for i, meal := range g.Meals {
+		calories := g.Targets.Calories * shares[i] / total
+		mealItems := g.pickFromSet(calories, inDay)
+		if mealItems == nil {
+			mealItems = g.pickFoods(meal, calories, inDay)
+		}
+		for j := range mealItems {
+			mealItems[j].Date = date
+			mealItems[j].Meal = meal
+			inDay[mealItems[j].FoodID] = true
+		}
+		items = append(items, mealItems...)
+	}
+	return items
+}
+
+// pickFromSet sometimes uses one of the user's food sets for a meal, scaled
+// to the meal's calories. Sets with foods that can't be picked are skipped.
+func (g *PlanGenerator) pickFromSet(calories float64, inDay map[uint]bool) []PlannedEntry {
+	if len(g.Sets) == 0 || g.rng.Float64() >= 0.25 {
+		return nil
+	}
+	set := g.Sets[g.rng.Intn(len(g.Sets))]
+	if len(set.Entries) == 0 {
+		return nil
+	}
+
+	var setCalories float64
+	for _, item := range set.Entries {
+		if !g.allowed[item.FoodID] || inDay[item.FoodID] || g.used[item.FoodID] >= g.MaxRepeats {
+			return nil
+		}
+		setCalories += item.Food.CaloriesFor(item.ServingGrams, item.Quantity)
+	}
+	if setCalories <= 0 {
+		return nil
+	}
+	scale := calories / setCalories
+	if scale < 0.5 || scale > 2 {
+		return nil
+	}
+
+	items := make([]PlannedEntry, len(set.Entries))
+	for i, item := range set.Entries {
+		items[i] = PlannedEntry{
+			FoodID:       item.FoodID,
+			Food:         item.Food,
+			ServingDesc:  item.ServingDesc,
+			ServingGrams: item.ServingGrams,
+			Quantity:     roundToStep(item.Quantity * scale),
+		}
+		items[i].SetNutrition(item.Food)
+	}
+	return items
+}
+
+// pickFoods picks a protein rich food, a carbohydrate rich food and for main
+// meals sometimes a third food, splitting the meal's calories between them
+func (g *PlanGenerator) pickFoods(meal string, calories float64, inDay map[uint]bool) []PlannedEntry {
+	kinds := []func(Food) bool{proteinRich, carbRich}
+	if meal == "snacks" {
+		kinds = []func(Food) bool{anyFood}
+	} else if g.rng.Float64() < 0.5 {
+		kinds = append(kinds, anyFood)
+	}
+
+	var items []PlannedEntry
+	picked := make(map[uint]bool)
+	for _, kind := range kinds {
+		food := g.pickFood(kind, inDay, picked)
+		if food == nil {
+			food = g.pickFood(anyFood, inDay, picked)
+		}
+		if food == nil {
+			continue
+		}
+		picked[food.ID] = true
+
+		serving := gramServing(food.Servings)
+		item := PlannedEntry{
+			FoodID:       food.ID,
+			Food:         *food,
+			ServingDesc:  serving.Description,
+			ServingGrams: serving.Grams,
+		}
+		share := calories / float64(len(kinds))
+		item.Quantity = roundToStep(share / food.CaloriesFor(serving.Grams, 1))
+		item.Quantity = clampQuantity(item.Quantity, serving.Grams)
+		item.SetNutrition(*food)
+		items = append(items, item)
+	}
+	return items
+}
+
+// pickFood picks a random food of a kind, favourites three times as likely
+func (g *PlanGenerator) pickFood(kind func(Food) bool, inDay, picked map[uint]bool) *Food {
+	var candidates []*Food
+	var weights []float64
+	var total float64
+	for i := range g.Foods {
+		food := &g.Foods[i]
+		if !kind(*food) || inDay[food.ID] || picked[food.ID] || g.used[food.ID] >= g.MaxRepeats {
+			continue
+		}
+		weight := 1.0
+		if g.Favorites[food.ID] {
+			weight = 3
+		}
+		candidates = append(candidates, food)
+		weights = append(weights, weight)
+		total += weight
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	r := g.rng.Float64() * total
+	for i, weight := range weights {
+		r -= weight
+		if r < 0 {
+			return candidates[i]
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// adjustPortions changes quantities a quarter serving at a time for as
+// long as that brings the day closer to the targets
+func (g *PlanGenerator) adjustPortions(items []PlannedEntry) {
+	totals := sumPlanned(items)
+	score := g.score(totals)
+	for iteration := 0; iteration < 200; iteration++ {
+		bestItem, bestQuantity, bestScore := -1, 0.0, score
+		for i := range items {
+			for _, step := range []float64{-0.25, 0.25} {
+				quantity := items[i].Quantity + step
+				if quantity != clampQuantity(quantity, items[i].ServingGrams) {
+					continue
+				}
+				change := items[i].Food.NutritionFor(items[i].ServingGrams, step)
+				candidate := totals
+				candidate.Add(change)
+				if s := g.score(candidate); s < bestScore-1e-9 {
+					bestItem, bestQuantity, bestScore = i, quantity, s
+				}
+			}
+		}
+		if bestItem < 0 {
+			return
+		}
+		items[bestItem].Quantity = bestQuantity
+		items[bestItem].SetNutrition(items[bestItem].Food)
+		totals = sumPlanned(items)
+		score = bestScore
+	}
+}
+
+// score sums the relative deviation from each target, calories counting
+// double
+func (g *PlanGenerator) score(totals Nutrition) float64 {
+	return 2*deviation(totals.Calories, g.Targets.Calories) +
+		deviation(totals.Protein, g.Targets.Protein) +
+		deviation(totals.Carbohydrates, g.Targets.Carbohydrates) +
+		deviation(totals.Fat, g.Targets.Fat)
+}
+
+func (g *PlanGenerator) withinTolerance(totals Nutrition) bool {
+	return deviation(totals.Calories, g.Targets.Calories) <= g.Tolerance &&
+		deviation(totals.Protein, g.Targets.Protein) <= g.Tolerance &&
+		deviation(totals.Carbohydrates, g.Targets.Carbohydrates) <= g.Tolerance &&
+		deviation(totals.Fat, g.Targets.Fat) <= g.Tolerance
+}
+
+// SetNutrition calculates the planned item's calories and macros
+func (p *PlannedEntry) SetNutrition(food Food) {
+	n := food.NutritionFor(p.ServingGrams, p.Quantity)
+	p.Calories, p.Protein, p.Carbohydrates, p.Fat = n.Calories, n.Protein, n.Carbohydrates, n.Fat
+}
+
+func sumPlanned(items []PlannedEntry) Nutrition {
+	var total Nutrition
+	for _, item := range items {
+		total.Add(Nutrition{
+			Calories:      item.Calories,
+			Protein:       item.Protein,
+			Carbohydrates: item.Carbohydrates,
+			Fat:           item.Fat,
+		})
+	}
+	return total
+}
+
+func roundNutrition(n Nutrition) Nutrition {
+	return Nutrition{
+		Calories:      roundTo(n.Calories, 1),
+		Protein:       roundTo(n.Protein, 1),
+		Carbohydrates: roundTo(n.Carbohydrates, 1),
+		Fat:           roundTo(n.Fat, 1),
+	}
+}
+
+func deviation(value, target float64) float64 {
+	if target <= 0 {
+		return 0
+	}
+	return math.Abs(value-target) / target
+}
+
+// gramServing returns the 100 grams serving, which all catalog foods have
+func gramServing(servings []FoodServing) *FoodServing {
+	for i := range servings {
+		if servings[i].Grams == 100 {
+			return &servings[i]
+		}
+	}
+	return nil
+}
+
+// roundToStep rounds a quantity to a quarter serving, at least one quarter
+func roundToStep(quantity float64) float64 {
+	return math.Max(0.25, math.Round(quantity*4)/4)
+}
+
+// clampQuantity keeps a portion between minItemGrams and maxItemGrams
+func clampQuantity(quantity, servingGrams float64) float64 {
+	if servingGrams <= 0 {
+		return quantity
+	}
+	low := math.Ceil(minItemGrams/servingGrams*4) / 4
+	high := math.Floor(maxItemGrams/servingGrams*4) / 4
+	return math.Min(math.Max(quantity, low), math.Max(high, low))
+}
+
+func proteinRich(food Food) bool {
+	return food.Protein*4 >= 0.3*float64(food.Calories)
+}
+
+func carbRich(food Food) bool {
+	return food.Carbohydrates*4 >= 0.5*float64(food.Calories)
+}
+
+func anyFood(Food) bool {
+	return true
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// IdempotencyKey stores the first response to a request sent with an
+// Idempotency-Key header so retries of it can be answered the same way
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primarykey"`
+	UserID      uint      `gorm:"uniqueIndex:idx_idempotency_user_key"`
+	Key         string    `gorm:"uniqueIndex:idx_idempotency_user_key"`
+	RequestHash string    // Hash of the method, path and body of the request
+	StatusCode  int       // Zero while the first request is still being handled
+	Body        []byte    // Response body to replay
+	CreatedAt   time.Time `gorm:"index"`
+}
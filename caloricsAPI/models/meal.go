@@ -0,0 +1,188 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Meals every user can log to, in the order they are shown
+var DefaultMeals = []string{"breakfast", "lunch", "dinner", "snacks"}
+
+// Nutrition holds calories and macros in grams
+type Nutrition struct {
+	Calories      float64 `json:"calories"`
+	Protein       float64 `json:"protein"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Fat           float64 `json:"fat"`
+}
+
+func (n *Nutrition) Add(other Nutrition) {
+	n.Calories += other.Calories
+	n.Protein += other.Protein
+	n.Carbohydrates += other.Carbohydrates
+	n.Fat += other.Fat
+}
+
+// Minus returns what is left of n after subtracting other
+func (n Nutrition) Minus(other Nutrition) Nutrition {
+	return Nutrition{
+		Calories:      n.Calories - other.Calories,
+		Protein:       n.Protein - other.Protein,
+		Carbohydrates: n.Carbohydrates - other.Carbohydrates,
+		Fat:           n.Fat - other.Fat,
+	}
+}
+
+// SumNutrition adds up the calories and macros of the entries
+func SumNutrition(entries []FoodEntry) Nutrition {
+	var total Nutrition
+	for _, entry := range entries {
+		total.Add(entry.Nutrition())
+	}
+	return total
+}
+
+// FoodEntryUpdate holds the fields of an entry that can be changed, nil
+// fields are left as they are
+type FoodEntryUpdate struct {
+	ServingDesc *string  `json:"serving_desc" binding:"omitempty,min=1"`
+	Quantity    *float64 `json:"quantity" binding:"omitempty,gt=0"`
+	Date        *string  `json:"date" binding:"omitempty,min=1"`
+	Meal        *string  `json:"meal"`
+	Time        *string  `json:"time"`
+}
+
+// Apply copies the set fields onto the entry
+func (u *FoodEntryUpdate) Apply(entry *FoodEntry) {
+	if u.ServingDesc != nil {
+		entry.ServingDesc = *u.ServingDesc
+	}
+	if u.Quantity != nil {
+		entry.Quantity = *u.Quantity
+	}
+	if u.Date != nil {
+		entry.Date = *u.Date
+	}
+	if u.Meal != nil {
+		entry.Meal = *u.Meal
+	}
+	if u.Time != nil {
+		entry.Time = *u.Time
+	}
+}
+
+type MealTotals struct {
+	Meal    string `json:"meal"`
+	Entries int    `json:"entries"`
+	Nutrition
+}
+
+// NormalizeMeal lowercases and trims a meal name
+func NormalizeMeal(meal string) string {
+	return strings.ToLower(strings.TrimSpace(meal))
+}
+
+// Meals returns the default meals followed by the user's own meals
+func (u *User) Meals() []string {
+	meals := append([]string{}, DefaultMeals...)
+	for _, meal := range u.CustomMeals {
+		if !slices.Contains(meals, meal) {
+			meals = append(meals, meal)
+		}
+	}
+	return meals
+}
+
+// HasMeal reports whether entries can be logged to the meal.
+// An empty meal leaves the entry unassigned.
+func (u *User) HasMeal(meal string) bool {
+	return meal == "" || slices.Contains(u.Meals(), meal)
+}
+
+// ValidTimeOfDay reports whether value is a time of day in HH:MM format
+func ValidTimeOfDay(value string) bool {
+	_, err := time.Parse("15:04", value)
+	return err == nil && len(value) == 5
+}
+
+// Nutrition returns the calories and macros of the entry
+func (e *FoodEntry) Nutrition() Nutrition {
+	return Nutrition{
+		Calories:      e.Calories,
+		Protein:       e.Protein,
+		Carbohydrates: e.Carbohydrates,
+		Fat:           e.Fat,
+	}
+}
+
+// CaloriesFor returns the calories in quantity servings of the given weight
+func (f Food) CaloriesFor(servingGrams, quantity float64) float64 {
+	// (calories per 100g * serving grams * quantity) / 100
+	return float64(f.Calories) * servingGrams * quantity / 100.0
+}
+
+// NutritionFor returns the calories and macros of quantity servings of the
+// given weight, from the food's values per 100g
+func (f Food) NutritionFor(servingGrams, quantity float64) Nutrition {
+	grams := servingGrams * quantity
+	return Nutrition{
+		Calories:      f.CaloriesFor(servingGrams, quantity),
+		Protein:       f.Protein * grams / 100.0,
+		Carbohydrates: f.Carbohydrates * grams / 100.0,
+		Fat:           f.Fat * grams / 100.0,
+	}
+}
+
+// SetNutrition calculates the entry's calories and macros from the food's
+// values per 100g, the serving grams and the quantity
+func (e *FoodEntry) SetNutrition(food Food) {
+	n := food.NutritionFor(e.ServingGrams, e.Quantity)
+	e.Calories, e.Protein, e.Carbohydrates, e.Fat = n.Calories, n.Protein, n.Carbohydrates, n.Fat
+}
+
+// Nutrition returns the calories and macros of the item
+func (i *FoodSetItem) Nutrition() Nutrition {
+	return Nutrition{
+		Calories:      i.Calories,
+		Protein:       i.Protein,
+		Carbohydrates: i.Carbohydrates,
+		Fat:           i.Fat,
+	}
+}
+
+// SetNutrition calculates the item's calories and macros like those of an
+// entry
+func (i *FoodSetItem) SetNutrition(food Food) {
+	n := food.NutritionFor(i.ServingGrams, i.Quantity)
+	i.Calories, i.Protein, i.Carbohydrates, i.Fat = n.Calories, n.Protein, n.Carbohydrates, n.Fat
+}
+
+// MealTotalsFor sums entries per meal. Every meal in meals is listed, even
+// without entries; unassigned entries are grouped under "unassigned".
+func MealTotalsFor(entries []FoodEntry, meals []string) []MealTotals {
+	totals := make([]MealTotals, 0, len(meals)+1)
+	index := make(map[string]int)
+	for _, meal := range meals {
+		index[meal] = len(totals)
+		totals = append(totals, MealTotals{Meal: meal})
+	}
+
+	for _, entry := range entries {
+		meal := entry.Meal
+		if meal == "" {
+			meal = "unassigned"
+		}
+		i, ok := index[meal]
+		if !ok {
+			// Meals the user removed since logging still get their own group
+			i = len(totals)
+			index[meal] = i
+			totals = append(totals, MealTotals{Meal: meal})
+		}
+		totals[i].Entries++
+		totals[i].Add(entry.Nutrition())
+	}
+
+	return totals
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Sort orders of the food entry list. Ties are broken by ID so pages stay
+// stable while entries are added.
+var EntrySorts = []string{"created_desc", "created_asc", "date_desc", "date_asc"}
+
+// EntryCursor points at the last entry of a page
+type EntryCursor struct {
+	Date string `json:"d,omitempty"`
+	ID   uint   `json:"id"`
+}
+
+// CursorFor returns the cursor of the page ending with entry
+func CursorFor(entry FoodEntry) EntryCursor {
+	return EntryCursor{Date: entry.Date, ID: entry.ID}
+}
+
+// Encode returns the cursor as an opaque URL safe string
+func (c EntryCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeEntryCursor reads a cursor returned by Encode
+func DecodeEntryCursor(value string) (EntryCursor, error) {
+	var cursor EntryCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlannedEntry is food the user plans to eat. It doesn't count toward the
+// calories consumed until it is marked as eaten, which logs a FoodEntry.
+type PlannedEntry struct {
+	gorm.Model
+	UserID        uint    `json:"user_id" gorm:"index"`
+	FoodID        uint    `json:"food_id" binding:"required"`
+	Food          Food    `json:"food" gorm:"foreignKey:FoodID" binding:"-"`
+	ServingDesc   string  `json:"serving_desc" binding:"required"`
+	ServingGrams  float64 `json:"serving_grams"`
+	Quantity      float64 `json:"quantity" binding:"required,gt=0"`
+	Date          string  `json:"date" binding:"required"`
+	Meal          string  `json:"meal"`
+	Time          string  `json:"time,omitempty"`
+	Calories      float64 `json:"calories"`
+	Protein       float64 `json:"protein"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Fat           float64 `json:"fat"`
+	FoodEntryID   *uint   `json:"food_entry_id,omitempty"` // Entry logged when the item was eaten
+}
+
+// EatRequest optionally changes a planned item when it is marked as eaten
+type EatRequest struct {
+	Quantity *float64 `json:"quantity" binding:"omitempty,gt=0"`
+	Date     *string  `json:"date"`
+	Time     *string  `json:"time"`
+}
+
+// PlanDay is one day of the plan view
+type PlanDay struct {
+	Date    string         `json:"date"`
+	Planned []PlannedEntry `json:"planned"`
+	Meals   []MealTotals   `json:"meals"`  // Planned totals per meal
+	Totals  Nutrition      `json:"totals"` // Planned totals
+	Logged  Nutrition      `json:"logged"` // Totals of the entries actually logged
+}
+
+// PlanDayStats compares what was planned for a day with what was logged
+type PlanDayStats struct {
+	Date            string  `json:"date"`
+	PlannedCalories float64 `json:"plannedCalories"`
+	EatenCalories   float64 `json:"eatenCalories"` // Planned items marked as eaten
+	LoggedCalories  float64 `json:"loggedCalories"`
+	Difference      float64 `json:"difference"` // Logged minus planned
+	PlannedItems    int     `json:"plannedItems"`
+	EatenItems      int     `json:"eatenItems"`
+}
+
+// ToFoodEntry returns an entry logging the planned item
+func (p *PlannedEntry) ToFoodEntry() FoodEntry {
+	return FoodEntry{
+		UserID:        p.UserID,
+		FoodID:        p.FoodID,
+		ServingDesc:   p.ServingDesc,
+		ServingGrams:  p.ServingGrams,
+		Quantity:      p.Quantity,
+		Date:          p.Date,
+		Meal:          p.Meal,
+		Time:          p.Time,
+		Calories:      p.Calories,
+		Protein:       p.Protein,
+		Carbohydrates: p.Carbohydrates,
+		Fat:           p.Fat,
+	}
+}
+
+// SetFromEntry copies the fields of a validated entry onto the planned item
+func (p *PlannedEntry) SetFromEntry(entry FoodEntry) {
+	p.FoodID = entry.FoodID
+	p.ServingDesc = entry.ServingDesc
+	p.ServingGrams = entry.ServingGrams
+	p.Quantity = entry.Quantity
+	p.Date = entry.Date
+	p.Meal = entry.Meal
+	p.Time = entry.Time
+	p.Calories = entry.Calories
+	p.Protein = entry.Protein
+	p.Carbohydrates = entry.Carbohydrates
+	p.Fat = entry.Fat
+}
+
+// DatesBetween returns every date from from to to, both YYYY-MM-DD and
+// included
+func DatesBetween(from, to string) ([]string, error) {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, err
+	}
+	var dates []string
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("2006-01-02"))
+	}
+	return dates, nil
+}
+
+// WeekOf returns the Monday and Sunday of the week containing date
+func WeekOf(date time.Time) (string, string) {
+	offset := (int(date.Weekday()) + 6) % 7
+	monday := date.AddDate(0, 0, -offset)
+	return monday.Format("2006-01-02"), monday.AddDate(0, 0, 6).Format("2006-01-02")
+}
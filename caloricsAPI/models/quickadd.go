@@ -0,0 +1,280 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsedItem is one food mentioned in a quick add text, e.g. "2 slices of bread"
+type ParsedItem struct {
+	Text     string  `json:"text"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit,omitempty"`  // Normalized unit, e.g. "slice" or "grams"
+	Grams    float64 `json:"grams,omitempty"` // Total weight when a weight unit was given
+	Name     string  `json:"name"`
+}
+
+// FoodMatch is a proposed food entry for a parsed item
+type FoodMatch struct {
+	Entry      FoodEntry `json:"entry"`
+	Confidence float64   `json:"confidence"`
+}
+
+type QuickAddProposal struct {
+	ParsedItem
+	Match        *FoodMatch  `json:"match"`
+	Alternatives []FoodMatch `json:"alternatives"`
+}
+
+// DefaultMinConfidence is the confidence best matches need to be logged
+// when the request doesn't set one
+const DefaultMinConfidence = 0.6
+
+// guessedServingConfidence is below DefaultMinConfidence so a guessed
+// serving is only logged when the client asks for it
+const guessedServingConfidence = 0.5
+
+type QuickAddRequest struct {
+	Text          string   `json:"text" binding:"required"`
+	Date          string   `json:"date"`
+	Meal          string   `json:"meal"`
+	Commit        bool     `json:"commit"`                                         // Log the best matches instead of only proposing them
+	MinConfidence *float64 `json:"min_confidence" binding:"omitempty,min=0,max=1"` // Best matches below this are not logged
+}
+
+var (
+	itemSeparator = regexp.MustCompile(`\s*(?:,|;|\n)\s*`)
+	joinSeparator = regexp.MustCompile(`(?i)\s+(?:and|plus|&|\+)\s+`)
+	quantityAtEnd = regexp.MustCompile(`^(\d+(?:[.,]\d+)?|\d+/\d+)([a-z]*)$`)
+)
+
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11,
+	"twelve": 12, "half": 0.5, "dozen": 12, "couple": 2,
+}
+
+// Weight units and their size in grams
+var weightUnits = map[string]float64{
+	"g": 1, "gr": 1, "gram": 1, "grams": 1, "kg": 1000, "kilogram": 1000, "kilograms": 1000,
+	"ml": 1, "milliliter": 1, "milliliters": 1, "l": 1000, "liter": 1000, "liters": 1000,
+	"oz": 28.35, "ounce": 28.35, "ounces": 28.35, "lb": 453.6, "lbs": 453.6, "pound": 453.6, "pounds": 453.6,
+}
+
+// Count units and the word to look for in serving descriptions
+var countUnits = map[string]string{
+	"slice": "slice", "slices": "slice",
+	"piece": "piece", "pieces": "piece", "pc": "piece", "pcs": "piece",
+	"medium": "piece", "whole": "piece", "large": "piece", "small": "piece",
+	"cup": "cup", "cups": "cup",
+	"tablespoon": "tablespoon", "tablespoons": "tablespoon", "tbsp": "tablespoon",
+	"teaspoon": "teaspoon", "teaspoons": "teaspoon", "tsp": "teaspoon",
+}
+
+// ParseFoodText splits a free text like "2 slices of bread, 1 egg and 200g
+// cottage cheese" into items with a quantity, unit and food name
+func ParseFoodText(text string) []ParsedItem {
+	var items []ParsedItem
+	for _, chunk := range itemSeparator.Split(strings.ToLower(text), -1) {
+		for _, part := range splitJoinedItems(chunk) {
+			if item, ok := parseItem(part); ok {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// splitJoinedItems splits on "and" only when a new quantity follows, so
+// "mac and cheese" stays one item while "bread and 2 eggs" becomes two
+func splitJoinedItems(chunk string) []string {
+	var parts []string
+	start := 0
+	for _, loc := range joinSeparator.FindAllStringIndex(chunk, -1) {
+		fields := strings.Fields(chunk[loc[1]:])
+		if len(fields) == 0 {
+			continue
+		}
+		if _, _, ok := parseQuantity(fields[0]); ok {
+			parts = append(parts, chunk[start:loc[0]])
+			start = loc[1]
+		}
+	}
+	return append(parts, chunk[start:])
+}
+
+func parseItem(text string) (ParsedItem, bool) {
+	text = strings.TrimSpace(text)
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ParsedItem{}, false
+	}
+
+	item := ParsedItem{Text: text, Quantity: 1}
+	if quantity, unit, ok := parseQuantity(fields[0]); ok {
+		item.Quantity = quantity
+		fields = fields[1:]
+		if unit != "" {
+			fields = append([]string{unit}, fields...)
+		}
+	}
+
+	if len(fields) > 0 {
+		if grams, ok := weightUnits[fields[0]]; ok {
+			item.Unit = "grams"
+			item.Grams = item.Quantity * grams
+			fields = fields[1:]
+		} else if unit, ok := countUnits[fields[0]]; ok {
+			item.Unit = unit
+			fields = fields[1:]
+		}
+	}
+	// Drop filler words, as in "2 slices of bread" or "half an apple"
+	for len(fields) > 0 && (fields[0] == "of" || fields[0] == "a" || fields[0] == "an") {
+		fields = fields[1:]
+	}
+
+	item.Name = strings.Join(fields, " ")
+	if item.Name == "" || item.Quantity <= 0 {
+		return ParsedItem{}, false
+	}
+	return item, true
+}
+
+// parseQuantity reads "2", "1.5", "1/2", "200g" or a number word
+func parseQuantity(field string) (float64, string, bool) {
+	if value, ok := numberWords[field]; ok {
+		return value, "", true
+	}
+
+	match := quantityAtEnd.FindStringSubmatch(field)
+	if match == nil {
+		return 0, "", false
+	}
+	unit := match[2]
+	if unit != "" {
+		if _, ok := weightUnits[unit]; !ok {
+			return 0, "", false
+		}
+	}
+
+	number := strings.Replace(match[1], ",", ".", 1)
+	if numerator, denominator, found := strings.Cut(number, "/"); found {
+		n, _ := strconv.ParseFloat(numerator, 64)
+		d, _ := strconv.ParseFloat(denominator, 64)
+		if d == 0 {
+			return 0, "", false
+		}
+		return n / d, unit, true
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return value, unit, true
+}
+
+// MatchParsedItem proposes food entries for an item, best match first.
+// Foods must have their servings loaded.
+func MatchParsedItem(item ParsedItem, foods []Food, maxResults int) []FoodMatch {
+	query := normalizeFoodName(item.Name)
+
+	type scored struct {
+		food  *Food
+		score float64
+	}
+	var candidates []scored
+	for i := range foods {
+		score := nameSimilarity(query, normalizeFoodName(foods[i].Name))
+		if score >= 0.5 {
+			candidates = append(candidates, scored{&foods[i], score})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].score != candidates[b].score {
+			return candidates[a].score > candidates[b].score
+		}
+		if len(candidates[a].food.Name) != len(candidates[b].food.Name) {
+			return len(candidates[a].food.Name) < len(candidates[b].food.Name)
+		}
+		return candidates[a].food.ID < candidates[b].food.ID
+	})
+
+	var matches []FoodMatch
+	for _, candidate := range candidates {
+		serving, quantity, servingScore, ok := pickServing(item, candidate.food.Servings)
+		if !ok {
+			continue
+		}
+		entry := FoodEntry{
+			FoodID:       candidate.food.ID,
+			Food:         *candidate.food,
+			ServingDesc:  serving.Description,
+			ServingGrams: serving.Grams,
+			Quantity:     quantity,
+		}
+		entry.SetNutrition(*candidate.food)
+		matches = append(matches, FoodMatch{
+			Entry:      entry,
+			Confidence: roundTo(candidate.score*servingScore, 3),
+		})
+		if len(matches) == maxResults {
+			break
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].Confidence > matches[b].Confidence
+	})
+	return matches
+}
+
+// pickServing chooses the serving that best fits the item's unit and
+// returns it with the quantity of that serving and how well it fits
+func pickServing(item ParsedItem, servings []FoodServing) (FoodServing, float64, float64, bool) {
+	if len(servings) == 0 {
+		return FoodServing{}, 0, 0, false
+	}
+
+	// Weights convert exactly, preferably to the 100 grams serving
+	if item.Unit == "grams" {
+		best := servings[0]
+		for _, serving := range servings {
+			if serving.Grams == 100 {
+				best = serving
+				break
+			}
+		}
+		if best.Grams <= 0 {
+			return FoodServing{}, 0, 0, false
+		}
+		return best, roundTo(item.Grams/best.Grams, 2), 1, true
+	}
+
+	// Counted units must appear in the serving description
+	word := item.Unit
+	if word == "" {
+		word = "piece"
+	}
+	for _, serving := range servings {
+		for _, token := range normalizeFoodName(serving.Description) {
+			if token == word {
+				if item.Unit == "" {
+					return serving, item.Quantity, 0.95, true
+				}
+				return serving, item.Quantity, 1, true
+			}
+		}
+	}
+
+	// Fall back to the largest gram based serving, which is a guess
+	best := servings[0]
+	for _, serving := range servings {
+		if serving.Grams > best.Grams {
+			best = serving
+		}
+	}
+	return best, item.Quantity, guessedServingConfidence, true
+}
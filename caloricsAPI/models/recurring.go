@@ -0,0 +1,138 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecurringEntry logs a food or the items of a food set on a schedule. An
+// entry is created for each day the rule occurs, once that day has begun in
+// the user's time zone.
+type RecurringEntry struct {
+	gorm.Model
+	UserID      uint     `json:"user_id" gorm:"index"`
+	FoodID      *uint    `json:"food_id,omitempty"` // Either a food with serving and quantity
+	ServingDesc string   `json:"serving_desc,omitempty"`
+	Quantity    float64  `json:"quantity,omitempty" binding:"omitempty,gt=0"`
+	FoodSetID   *uint    `json:"food_set_id,omitempty"` // or a food set
+	Meal        string   `json:"meal"`
+	Time        string   `json:"time,omitempty"`
+	Frequency   string   `json:"frequency" binding:"required,oneof=daily weekdays weekly interval"`
+	Days        []int    `json:"days,omitempty" gorm:"serializer:json" binding:"omitempty,dive,min=0,max=6"` // Weekdays for "weekly", 0 is Sunday
+	Interval    int      `json:"interval,omitempty" binding:"omitempty,min=1"`                               // Days between occurrences for "interval"
+	StartDate   string   `json:"start_date"`
+	EndDate     string   `json:"end_date,omitempty"`
+	SkipDates   []string `json:"skip_dates,omitempty" gorm:"serializer:json" binding:"-"`
+	LastDate    string   `json:"last_date,omitempty" binding:"-"` // Last date entries were created for
+}
+
+// MaxRecurringBackfillDays is how many days back a rule may start and how
+// far entries are caught up after the server was down
+const MaxRecurringBackfillDays = 31
+
+type RecurringDateRequest struct {
+	Date string `json:"date"`
+}
+
+// Validate checks that the rule logs exactly one food or set and that its
+// schedule is complete and starts at most MaxRecurringBackfillDays before
+// today
+func (r *RecurringEntry) Validate(today string) error {
+	if (r.FoodID == nil) == (r.FoodSetID == nil) {
+		return errors.New("Set either food_id or food_set_id")
+	}
+	if r.FoodID != nil && (r.ServingDesc == "" || r.Quantity <= 0) {
+		return errors.New("serving_desc and quantity are required with food_id")
+	}
+	if r.Frequency == "weekly" && len(r.Days) == 0 {
+		return errors.New("days are required for weekly rules")
+	}
+	if r.Frequency == "interval" && r.Interval < 1 {
+		return errors.New("interval is required for interval rules")
+	}
+	if _, err := time.Parse("2006-01-02", r.StartDate); err != nil {
+		return errors.New("Invalid start date format. Use YYYY-MM-DD")
+	}
+	if r.StartDate < backfillStart(today) {
+		return fmt.Errorf("start_date can be at most %d days ago", MaxRecurringBackfillDays)
+	}
+	if r.EndDate != "" {
+		if _, err := time.Parse("2006-01-02", r.EndDate); err != nil {
+			return errors.New("Invalid end date format. Use YYYY-MM-DD")
+		}
+		if r.EndDate < r.StartDate {
+			return errors.New("end_date must not be before start_date")
+		}
+	}
+	return nil
+}
+
+// Occurs reports whether the rule logs entries on the date
+func (r *RecurringEntry) Occurs(date time.Time) bool {
+	day := date.Format("2006-01-02")
+	if day < r.StartDate || (r.EndDate != "" && day > r.EndDate) || slices.Contains(r.SkipDates, day) {
+		return false
+	}
+
+	switch r.Frequency {
+	case "daily":
+		return true
+	case "weekdays":
+		return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+	case "weekly":
+		for _, weekday := range r.Days {
+			if int(date.Weekday()) == weekday {
+				return true
+			}
+		}
+		return false
+	case "interval":
+		start, _ := time.Parse("2006-01-02", r.StartDate)
+		days := int(date.Sub(start).Hours()/24 + 0.5)
+		return r.Interval > 0 && days%r.Interval == 0
+	}
+	return false
+}
+
+// backfillStart returns the earliest date entries are created for
+func backfillStart(today string) string {
+	parsed, err := time.Parse("2006-01-02", today)
+	if err != nil {
+		return ""
+	}
+	return parsed.AddDate(0, 0, -MaxRecurringBackfillDays).Format("2006-01-02")
+}
+
+// PendingDates returns the dates up to today that entries still have to be
+// created for, going back at most MaxRecurringBackfillDays
+func (r *RecurringEntry) PendingDates(today string) []time.Time {
+	from := r.StartDate
+	if r.LastDate != "" && r.LastDate >= from {
+		last, _ := time.Parse("2006-01-02", r.LastDate)
+		from = last.AddDate(0, 0, 1).Format("2006-01-02")
+	}
+	if earliest := backfillStart(today); from < earliest {
+		from = earliest
+	}
+	to := today
+	if r.EndDate != "" && r.EndDate < to {
+		to = r.EndDate
+	}
+
+	dates, err := DatesBetween(from, to)
+	if err != nil {
+		return nil
+	}
+	var pending []time.Time
+	for _, value := range dates {
+		date, _ := time.Parse("2006-01-02", value)
+		if r.Occurs(date) {
+			pending = append(pending, date)
+		}
+	}
+	return pending
+}
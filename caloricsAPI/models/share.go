@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// FoodSetShare gives a user access to another user's food set. Shares with
+// an email that has no account yet are pending until it registers.
+type FoodSetShare struct {
+	gorm.Model
+	FoodSetID uint   `json:"food_set_id" gorm:"index"`
+	UserID    uint   `json:"user_id" gorm:"index"` // User the set is shared with, 0 while pending
+	Email     string `json:"email" gorm:"index"`   // Lower case address the set was shared with
+}
+
+// ShareFoodSetRequest changes who can see a food set. Emails replaces the
+// addresses the set is shared with when present, whether or not they have
+// an account. Private sets can't be shared with users, making a set private
+// removes its shares.
+type ShareFoodSetRequest struct {
+	Visibility string    `json:"visibility" binding:"omitempty,oneof=private link public"`
+	Emails     *[]string `json:"emails" binding:"omitempty,dive,email"`
+}
+
+// SharedFoodSet is a food set as shown to users other than its owner
+type SharedFoodSet struct {
+	FoodSet
+	UserID *uint  `json:"user_id,omitempty"` // Always nil, hides the owner's ID of the embedded set
+	Owner  string `json:"owner"`
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ShoppingItem is a food to buy with the amount needed
+type ShoppingItem struct {
+	FoodID   uint    `json:"food_id"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Grams    float64 `json:"grams"`    // Total weight needed
+	Quantity float64 `json:"quantity"` // Amount to buy in Unit
+	Unit     string  `json:"unit"`     // "g", "kg" or "pieces"
+	Checked  bool    `json:"checked"`
+}
+
+type ShoppingCategory struct {
+	Category string         `json:"category"`
+	Items    []ShoppingItem `json:"items"`
+}
+
+// ShoppingListCheck marks a food as bought on the list for a date range
+type ShoppingListCheck struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"uniqueIndex:idx_shopping_check"`
+	ListKey   string `gorm:"uniqueIndex:idx_shopping_check"` // "from:to" of the list
+	FoodID    uint   `gorm:"uniqueIndex:idx_shopping_check"`
+	CreatedAt time.Time
+}
+
+type ShoppingCheckRequest struct {
+	From    string `json:"from" binding:"required"`
+	To      string `json:"to" binding:"required"`
+	FoodID  uint   `json:"food_id" binding:"required"`
+	Checked bool   `json:"checked"`
+}
+
+// ShoppingListKey identifies the list for a date range
+func ShoppingListKey(from, to string) string {
+	return from + ":" + to
+}
+
+// ShoppingList adds up the weight needed per food
+type ShoppingList struct {
+	grams map[uint]float64
+	foods map[uint]Food
+}
+
+func NewShoppingList() *ShoppingList {
+	return &ShoppingList{grams: make(map[uint]float64), foods: make(map[uint]Food)}
+}
+
+// Add adds grams of a food. The food's servings are used to suggest pieces.
+func (l *ShoppingList) Add(food Food, grams float64) {
+	if grams <= 0 {
+		return
+	}
+	l.grams[food.ID] += grams
+	l.foods[food.ID] = food
+}
+
+// Categories returns the items grouped by category, both sorted by name
+func (l *ShoppingList) Categories(checked map[uint]bool) []ShoppingCategory {
+	byCategory := make(map[string][]ShoppingItem)
+	for id, grams := range l.grams {
+		food := l.foods[id]
+		category := food.Category
+		if category == "" {
+			category = "Other"
+		}
+		quantity, unit := PurchasableQuantity(food, grams)
+		byCategory[category] = append(byCategory[category], ShoppingItem{
+			FoodID:   id,
+			Name:     food.Name,
+			Category: category,
+			Grams:    math.Round(grams),
+			Quantity: quantity,
+			Unit:     unit,
+			Checked:  checked[id],
+		})
+	}
+
+	categories := make([]ShoppingCategory, 0, len(byCategory))
+	for category, items := range byCategory {
+		sort.Slice(items, func(a, b int) bool {
+			if items[a].Name != items[b].Name {
+				return items[a].Name < items[b].Name
+			}
+			return items[a].FoodID < items[b].FoodID
+		})
+		categories = append(categories, ShoppingCategory{Category: category, Items: items})
+	}
+	sort.Slice(categories, func(a, b int) bool { return categories[a].Category < categories[b].Category })
+	return categories
+}
+
+// PurchasableQuantity converts grams to what is bought in a shop: whole
+// pieces for foods with a piece serving, otherwise grams rounded up to 10 g
+// or kilograms rounded up to 100 g
+func PurchasableQuantity(food Food, grams float64) (float64, string) {
+	for _, serving := range food.Servings {
+		if serving.Grams <= 0 {
+			continue
+		}
+		for _, token := range normalizeFoodName(serving.Description) {
+			if token == "piece" {
+				return math.Ceil(grams/serving.Grams - 1e-9), "pieces"
+			}
+		}
+	}
+	if grams >= 1000 {
+		return math.Ceil(grams/100-1e-9) / 10, "kg"
+	}
+	return math.Ceil(grams/10-1e-9) * 10, "g"
+}
+
+// ShoppingListText formats the list as plain text with check boxes
+func ShoppingListText(title string, categories []ShoppingCategory) string {
+	var b strings.Builder
+	b.WriteString(title + "\n")
+	for _, category := range categories {
+		b.WriteString("\n" + category.Category + "\n")
+		for _, item := range category.Items {
+			box := "[ ]"
+			if item.Checked {
+				box = "[x]"
+			}
+			fmt.Fprintf(&b, "%s %s - %s %s\n", box, item.Name, formatAmount(item.Quantity), item.Unit)
+		}
+	}
+	return b.String()
+}
+
+// WriteShoppingListCSV writes the list as CSV with a header row
+func WriteShoppingListCSV(w io.Writer, categories []ShoppingCategory) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"category", "food", "quantity", "unit", "grams", "checked"})
+	for _, category := range categories {
+		for _, item := range category.Items {
+			writer.Write([]string{
+				csvText(category.Category),
+				csvText(item.Name),
+				formatAmount(item.Quantity),
+				csvText(item.Unit),
+				formatAmount(item.Grams),
+				fmt.Sprint(item.Checked),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvText keeps spreadsheets from running text as a formula by prefixing
+// values that start like one with a quote
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func formatAmount(value float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", value), "0"), ".")
+}
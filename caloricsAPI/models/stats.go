@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MaxStatsDays is the longest range the weekly stats can cover
+const MaxStatsDays = 92
+
+// CalorieTolerance is how far from the calorie target a day can land and
+// still count as on target
+const CalorieTolerance = 0.1
+
+// DayStats are the totals logged on one day of a stats range
+type DayStats struct {
+	Date       string    `json:"date"`
+	Totals     Nutrition `json:"totals"`
+	Entries    int       `json:"entries"`
+	Percentage float64   `json:"percentage"` // Calories as a percentage of the target
+	Status     string    `json:"status"`     // not_logged, under, on_target or over
+}
+
+// MacroSplit is the share of calories from each macro, in percent
+type MacroSplit struct {
+	Protein       float64 `json:"protein"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Fat           float64 `json:"fat"`
+}
+
+// WeeklyStats summarizes a range of days. Averages only count the days
+// that have entries.
+type WeeklyStats struct {
+	TotalCalories     float64      `json:"totalCalories"`
+	AveragePercentage float64      `json:"averagePercentage"` // Average calories per logged day as a percentage of the target
+	AverageCalories   float64      `json:"averageCalories"`
+	Totals            Nutrition    `json:"totals"`
+	Averages          Nutrition    `json:"averages"`
+	Targets           Nutrition    `json:"targets"` // Daily targets
+	MacroSplit        MacroSplit   `json:"macroSplit"`
+	DaysInRange       int          `json:"daysInRange"`
+	DaysLogged        int          `json:"daysLogged"`
+	DaysUnder         int          `json:"daysUnder"`
+	DaysOnTarget      int          `json:"daysOnTarget"`
+	DaysOver          int          `json:"daysOver"`
+	Days              []DayStats   `json:"days"`
+	Meals             []MealTotals `json:"meals"`
+}
+
+// StatsRange checks a range of YYYY-MM-DD dates and returns every date in
+// it
+func StatsRange(from, to string) ([]string, error) {
+	if from == "" || to == "" {
+		return nil, errors.New("Start date and end date are required")
+	}
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, errors.New("Invalid start date format. Use YYYY-MM-DD")
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return nil, errors.New("Invalid end date format. Use YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return nil, errors.New("End date must not be before start date")
+	}
+	if end.Sub(start) >= MaxStatsDays*24*time.Hour {
+		return nil, fmt.Errorf("Range can't be longer than %d days", MaxStatsDays)
+	}
+	return DatesBetween(from, to)
+}
+
+// CalorieStatus tells whether calories landed under, on or over the target
+func CalorieStatus(calories, target float64) string {
+	switch {
+	case target <= 0:
+		return "on_target"
+	case calories < target*(1-CalorieTolerance):
+		return "under"
+	case calories > target*(1+CalorieTolerance):
+		return "over"
+	}
+	return "on_target"
+}
+
+// MacroSplitOf returns the share of calories from each macro
+func MacroSplitOf(n Nutrition) MacroSplit {
+	calories := n.Protein*4 + n.Carbohydrates*4 + n.Fat*9
+	if calories == 0 {
+		return MacroSplit{}
+	}
+	return MacroSplit{
+		Protein:       math.Round(n.Protein*4/calories*1000) / 10,
+		Carbohydrates: math.Round(n.Carbohydrates*4/calories*1000) / 10,
+		Fat:           math.Round(n.Fat*9/calories*1000) / 10,
+	}
+}
+
+// NewWeeklyStats summarizes the entries logged on the dates against the
+// daily targets
+func NewWeeklyStats(entries []FoodEntry, dates []string, targets Nutrition, meals []string) WeeklyStats {
+	byDate := make(map[string][]FoodEntry)
+	for _, entry := range entries {
+		byDate[entry.Date] = append(byDate[entry.Date], entry)
+	}
+
+	stats := WeeklyStats{
+		Targets:     targets,
+		DaysInRange: len(dates),
+		Days:        make([]DayStats, 0, len(dates)),
+		Meals:       MealTotalsFor(entries, meals),
+	}
+	for _, date := range dates {
+		day := DayStats{
+			Date:    date,
+			Totals:  SumNutrition(byDate[date]),
+			Entries: len(byDate[date]),
+			Status:  "not_logged",
+		}
+		if day.Entries > 0 {
+			if targets.Calories > 0 {
+				day.Percentage = day.Totals.Calories / targets.Calories * 100
+			}
+			day.Status = CalorieStatus(day.Totals.Calories, targets.Calories)
+			switch day.Status {
+			case "under":
+				stats.DaysUnder++
+			case "over":
+				stats.DaysOver++
+			default:
+				stats.DaysOnTarget++
+			}
+			stats.DaysLogged++
+		}
+		stats.Totals.Add(day.Totals)
+		stats.Days = append(stats.Days, day)
+	}
+
+	stats.TotalCalories = stats.Totals.Calories
+	stats.MacroSplit = MacroSplitOf(stats.Totals)
+	if stats.DaysLogged > 0 {
+		days := float64(stats.DaysLogged)
+		stats.Averages = Nutrition{
+			Calories:      stats.Totals.Calories / days,
+			Protein:       stats.Totals.Protein / days,
+			Carbohydrates: stats.Totals.Carbohydrates / days,
+			Fat:           stats.Totals.Fat / days,
+		}
+		stats.AverageCalories = stats.Averages.Calories
+		if targets.Calories > 0 {
+			stats.AveragePercentage = stats.AverageCalories / targets.Calories * 100
+		}
+	}
+	return stats
+}
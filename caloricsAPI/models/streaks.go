@@ -0,0 +1,139 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// AdherenceDays is how many days the adherence history covers
+const AdherenceDays = 30
+
+// Streak is a run of consecutive days. The current streak is still alive
+// when it ended today or yesterday, as today may not be logged yet.
+type Streak struct {
+	Current   int    `json:"current"`
+	Best      int    `json:"best"`
+	BestStart string `json:"bestStart,omitempty"`
+	BestEnd   string `json:"bestEnd,omitempty"`
+}
+
+// AdherenceDay scores how close one day landed to the targets
+type AdherenceDay struct {
+	Date   string    `json:"date"`
+	Logged bool      `json:"logged"`
+	Totals Nutrition `json:"totals"`
+	Score  float64   `json:"score"`  // 0 to 100, 0 when nothing was logged
+	Status string    `json:"status"` // As in DayStats
+}
+
+// AdherenceScore rates the totals of a day from 0 to 100. Calories count
+// for 40% and each macro for 20%, each losing points in proportion to how
+// far it is from its target.
+func AdherenceScore(totals, targets Nutrition) float64 {
+	closeness := func(actual, target float64) float64 {
+		if target <= 0 {
+			return 1
+		}
+		return math.Max(0, 1-math.Abs(actual-target)/target)
+	}
+	score := 0.4*closeness(totals.Calories, targets.Calories) +
+		0.2*closeness(totals.Protein, targets.Protein) +
+		0.2*closeness(totals.Carbohydrates, targets.Carbohydrates) +
+		0.2*closeness(totals.Fat, targets.Fat)
+	return math.Round(score*1000) / 10
+}
+
+// streakOf finds the runs of consecutive dates in days, which must be
+// sorted, for which matches is true
+func streakOf(days []AnalyticsRow, today string, matches func(AnalyticsRow) bool) Streak {
+	var streak Streak
+	run, runStart, last := 0, "", ""
+	for _, day := range days {
+		if !matches(day) {
+			run, last = 0, ""
+			continue
+		}
+		if last != "" && nextDate(last) == day.Bucket {
+			run++
+		} else {
+			run, runStart = 1, day.Bucket
+		}
+		last = day.Bucket
+		if run > streak.Best {
+			streak.Best, streak.BestStart, streak.BestEnd = run, runStart, day.Bucket
+		}
+	}
+	if last == today || nextDate(last) == today {
+		streak.Current = run
+	}
+	return streak
+}
+
+// nextDate returns the day after a YYYY-MM-DD date
+func nextDate(date string) string {
+	parsed, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	return parsed.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// Streaks returns the streak of days with entries and the streak of days
+// within the calorie target from the daily totals, sorted by date. Today
+// only counts toward the target streak once it is on target.
+func Streaks(days []AnalyticsRow, today string, targets Nutrition) (Streak, Streak) {
+	logging := streakOf(days, today, func(day AnalyticsRow) bool {
+		return day.Entries > 0
+	})
+	onTarget := func(day AnalyticsRow) bool {
+		return day.Entries > 0 && CalorieStatus(day.Calories, targets.Calories) == "on_target"
+	}
+	// Leave out today while it isn't on target, it may still get there
+	completed := days
+	if n := len(days); n > 0 && days[n-1].Bucket == today && !onTarget(days[n-1]) {
+		completed = days[:n-1]
+	}
+	return logging, streakOf(completed, today, onTarget)
+}
+
+// AdherenceHistory scores each of the dates from the daily totals
+func AdherenceHistory(days []AnalyticsRow, dates []string, targets Nutrition) []AdherenceDay {
+	byDate := make(map[string]AnalyticsRow)
+	for _, day := range days {
+		byDate[day.Bucket] = day
+	}
+
+	history := make([]AdherenceDay, 0, len(dates))
+	for _, date := range dates {
+		adherence := AdherenceDay{Date: date, Status: "not_logged"}
+		if day, ok := byDate[date]; ok && day.Entries > 0 {
+			adherence.Logged = true
+			adherence.Totals = Nutrition{
+				Calories:      day.Calories,
+				Protein:       day.Protein,
+				Carbohydrates: day.Carbohydrates,
+				Fat:           day.Fat,
+			}
+			adherence.Score = AdherenceScore(adherence.Totals, targets)
+			adherence.Status = CalorieStatus(day.Calories, targets.Calories)
+		}
+		history = append(history, adherence)
+	}
+	return history
+}
+
+// AverageAdherence averages the scores of the logged days
+func AverageAdherence(history []AdherenceDay) float64 {
+	var total float64
+	var logged int
+	for _, day := range history {
+		if day.Logged {
+			total += day.Score
+			logged++
+		}
+	}
+	if logged == 0 {
+		return 0
+	}
+	return math.Round(total/float64(logged)*10) / 10
+}
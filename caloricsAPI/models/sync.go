@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// SyncToken marks the moment of a sync pull. Changes made after it are
+// returned by the next pull.
+type SyncToken time.Time
+
+// SyncOverlap is how far before the database time a new token is set, so
+// changes stamped just before a pull but committed after it are returned
+// again by the next pull instead of being skipped
+const SyncOverlap = 5 * time.Second
+
+// unixEpochJulianDay is the julian day number of 1970-01-01 00:00 UTC
+const unixEpochJulianDay = 2440587.5
+
+// SyncTokenFromJulianDay returns the token for a julianday() value read
+// from the database, minus SyncOverlap
+func SyncTokenFromJulianDay(day float64) SyncToken {
+	nanos := int64((day - unixEpochJulianDay) * 86400 * float64(time.Second))
+	return SyncToken(time.Unix(0, nanos).Add(-SyncOverlap).UTC())
+}
+
+// JulianDay returns the token as a julianday() value. Timestamps are
+// compared as julian days in SQL because they are stored as text with the
+// zone offset of the server, which doesn't sort correctly against UTC.
+func (t SyncToken) JulianDay() float64 {
+	return float64(time.Time(t).UnixNano())/(86400*float64(time.Second)) + unixEpochJulianDay
+}
+
+// Encode returns the token as an opaque string
+func (t SyncToken) Encode() string {
+	nanos := strconv.FormatInt(time.Time(t).UnixNano(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(nanos))
+}
+
+// DecodeSyncToken reads a token returned by Encode
+func DecodeSyncToken(value string) (SyncToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return SyncToken{}, err
+	}
+	nanos, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || nanos <= 0 {
+		return SyncToken{}, errors.New("invalid sync token")
+	}
+	return SyncToken(time.Unix(0, nanos).UTC()), nil
+}
+
+// SyncChanges lists the records of one kind changed since a sync token
+type SyncChanges[T any] struct {
+	Updated []T    `json:"updated"`
+	Deleted []uint `json:"deleted"`
+}
+
+// SyncPush is a batch of changes a client made while offline
+type SyncPush struct {
+	// "version" rejects changes to entries modified since the client last
+	// saw them, "last_write_wins" keeps whichever change was made last
+	Strategy string            `json:"strategy" binding:"omitempty,oneof=version last_write_wins"`
+	Entries  []SyncEntryChange `json:"entries" binding:"max=500,dive"`
+}
+
+// SyncEntryChange creates, updates or deletes one food entry. New entries
+// have no ID and are identified by the client's own ID instead.
+type SyncEntryChange struct {
+	ID            uint       `json:"id"`
+	ClientID      string     `json:"client_id"`
+	BaseUpdatedAt *time.Time `json:"base_updated_at"` // Version of the entry the change was made to
+	ChangedAt     time.Time  `json:"changed_at"`      // When the client made the change
+	Deleted       bool       `json:"deleted"`
+	FoodID        uint       `json:"food_id"`
+	ServingDesc   string     `json:"serving_desc"`
+	Quantity      *float64   `json:"quantity" binding:"omitempty,gt=0"` // Required unless the entry is deleted
+	Date          string     `json:"date"`
+	Meal          string     `json:"meal"`
+	Time          string     `json:"time"`
+}
+
+// SyncResult reports what happened to one pushed change. Conflicts include
+// the server's version of the entry.
+type SyncResult struct {
+	ClientID string     `json:"client_id,omitempty"`
+	ID       uint       `json:"id,omitempty"`
+	Status   string     `json:"status"` // "applied", "conflict" or "error"
+	Entry    *FoodEntry `json:"entry,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Apply copies the change onto the entry
+func (c *SyncEntryChange) Apply(entry *FoodEntry) {
+	entry.FoodID = c.FoodID
+	entry.ServingDesc = c.ServingDesc
+	if c.Quantity != nil {
+		entry.Quantity = *c.Quantity
+	}
+	entry.Date = c.Date
+	entry.Meal = c.Meal
+	entry.Time = c.Time
+}
+
+// ConflictsWith reports whether the change must not overwrite the entry's
+// current version under the given strategy
+func (c *SyncEntryChange) ConflictsWith(entry FoodEntry, strategy string) bool {
+	if strategy == "last_write_wins" {
+		return c.ChangedAt.Before(entry.UpdatedAt)
+	}
+	return c.BaseUpdatedAt == nil || !c.BaseUpdatedAt.Equal(entry.UpdatedAt)
+}
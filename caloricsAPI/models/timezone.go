@@ -0,0 +1,64 @@
+package models
+
+import (
+	"log"
+	"time"
+)
+
+// ValidTimeZone reports whether name is an IANA time zone such as
+// "Europe/Istanbul". An empty name is valid and means the server's zone.
+func ValidTimeZone(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// Location returns the user's time zone, or the server's when none is set
+func (u *User) Location() *time.Location {
+	if u.TimeZone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		log.Printf("Error loading time zone %q: %v", u.TimeZone, err)
+		return time.Local
+	}
+	return location
+}
+
+// Now returns the current time in the user's time zone
+func (u *User) Now() time.Time {
+	return time.Now().In(u.Location())
+}
+
+// Today returns the user's current date as YYYY-MM-DD
+func (u *User) Today() string {
+	return u.Now().Format("2006-01-02")
+}
+
+// SetConsumedAt stores when the entry was eaten. An entry with a time of day
+// is placed at that time on its date in the user's zone, one logged for
+// today without a time at the current moment. Other entries have no
+// timestamp.
+func (e *FoodEntry) SetConsumedAt(user *User) {
+	if e.Time != "" {
+		consumedAt, err := time.ParseInLocation("2006-01-02 15:04", e.Date+" "+e.Time, user.Location())
+		if err == nil {
+			consumedAt = consumedAt.UTC()
+			e.ConsumedAt = &consumedAt
+			return
+		}
+	}
+	// Keep an earlier timestamp while the entry stays on the same date
+	if e.ConsumedAt != nil && e.ConsumedAt.In(user.Location()).Format("2006-01-02") == e.Date {
+		return
+	}
+	if e.Date == user.Today() {
+		now := time.Now().UTC()
+		e.ConsumedAt = &now
+		return
+	}
+	e.ConsumedAt = nil
+}
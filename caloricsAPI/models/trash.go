@@ -0,0 +1,20 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type UndoRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// NewRandomToken returns a random hex token, e.g. to identify the entries
+// removed by one delete call or to share a food set by link
+func NewRandomToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
@@ -23,20 +23,29 @@ type User struct {
 	HipMeasure    int         `json:"hip_measure,omitempty"`
 	FatPercentage int         `json:"fat_percentage,omitempty" gorm:"->"`
 	Goal          string      `json:"goal" gorm:"default:'maintain'" binding:"omitempty,oneof=lose maintain gain"`
+	IsAdmin       bool        `json:"-" gorm:"default:false"`
+	DietaryPrefs  []string    `json:"dietary_preferences,omitempty" gorm:"serializer:json" binding:"omitempty,dive,oneof=vegan vegetarian gluten-free lactose-free halal kosher"`
+	Allergens     []string    `json:"allergens,omitempty" gorm:"serializer:json" binding:"omitempty,dive,oneof=celery gluten crustaceans eggs fish lupin milk molluscs mustard nuts peanuts sesame soybeans sulphites"`
+	CustomMeals   []string    `json:"custom_meals,omitempty" gorm:"serializer:json" binding:"-"` // Meals added to DefaultMeals by the user
+	TimeZone      string      `json:"time_zone,omitempty"`                                       // IANA zone for dates and ages, the server's when empty
 	FoodEntries   []FoodEntry `json:"food_entries,omitempty" gorm:"foreignKey:UserID"`
 }
 
 type UserStats struct {
-	DailyCalories    float64     `json:"dailyCalories"`
-	NeededCalories   int         `json:"neededCalories"`
-	CurrentWeight    int         `json:"currentWeight"`
-	NeckMeasurement  int         `json:"neckMeasurement"`
-	WaistMeasurement int         `json:"waistMeasurement"`
-	HipMeasurement   int         `json:"hipMeasurement"`
-	FatPercentage    int         `json:"fatPercentage"`
-	Goal             string      `json:"goal"`
-	Age              int         `json:"age"`
-	FoodEntries      []FoodEntry `json:"foodEntries"`
+	DailyCalories    float64      `json:"dailyCalories"`
+	NeededCalories   int          `json:"neededCalories"`
+	CurrentWeight    int          `json:"currentWeight"`
+	NeckMeasurement  int          `json:"neckMeasurement"`
+	WaistMeasurement int          `json:"waistMeasurement"`
+	HipMeasurement   int          `json:"hipMeasurement"`
+	FatPercentage    int          `json:"fatPercentage"`
+	Goal             string       `json:"goal"`
+	Age              int          `json:"age"`
+	FoodEntries      []FoodEntry  `json:"foodEntries"`
+	Meals            []MealTotals `json:"meals"`
+	Totals           Nutrition    `json:"totals"`
+	Targets          Nutrition    `json:"targets"`
+	Remaining        Nutrition    `json:"remaining"`
 }
 
 type LoginRequest struct {
@@ -138,10 +147,42 @@ func (u *User) CalculateNeededCalories() int {
 	}
 }
 
+// CalculateMacroTargets splits the needed calories into daily protein,
+// carbohydrate and fat targets in grams
+func (u *User) CalculateMacroTargets() Nutrition {
+	calories := float64(u.CalculateNeededCalories())
+
+	// Protein per kg of body weight, higher when losing to preserve muscle
+	var proteinPerKg float64
+	switch u.Goal {
+	case "lose":
+		proteinPerKg = 2.0
+	case "gain":
+		proteinPerKg = 1.8
+	default:
+		proteinPerKg = 1.6
+	}
+	protein := proteinPerKg * float64(u.Weight)
+	if u.Weight == 0 {
+		protein = calories * 0.25 / 4 // 25% of calories without a weight
+	}
+
+	// 25% of calories from fat, the rest from carbohydrates
+	fat := calories * 0.25 / 9
+	carbohydrates := math.Max(0, (calories-protein*4-fat*9)/4)
+
+	return Nutrition{
+		Calories:      calories,
+		Protein:       math.Round(protein),
+		Carbohydrates: math.Round(carbohydrates),
+		Fat:           math.Round(fat),
+	}
+}
+
 func (u *User) GetStats() UserStats {
 	// Calculate daily calories consumed
 	var dailyCalories float64
-	today := time.Now().Format("2006-01-02")
+	today := u.Today()
 	var todaysFoodEntries []FoodEntry
 
 	for _, entry := range u.FoodEntries {
@@ -154,6 +195,8 @@ func (u *User) GetStats() UserStats {
 	// Ensure fat percentage is calculated
 	u.CalculateFatPercentage()
 	u.CalculateAge()
+	totals := SumNutrition(todaysFoodEntries)
+	targets := u.CalculateMacroTargets()
 	stats := UserStats{
 		DailyCalories:    dailyCalories,
 		NeededCalories:   u.CalculateNeededCalories(),
@@ -165,6 +208,10 @@ func (u *User) GetStats() UserStats {
 		Goal:             u.Goal,
 		Age:              u.Age,
 		FoodEntries:      todaysFoodEntries,
+		Meals:            MealTotalsFor(todaysFoodEntries, u.Meals()),
+		Totals:           totals,
+		Targets:          targets,
+		Remaining:        targets.Minus(totals),
 	}
 
 	return stats
@@ -177,7 +224,7 @@ func (u *User) CalculateAge() int {
 		return 0
 	}
 
-	now := time.Now()
+	now := u.Now()
 	age := now.Year() - birthDate.Year()
 
 	// Adjust age if birthday hasn't occurred this year
@@ -209,13 +256,20 @@ func (u *User) BeforeUpdate(tx *gorm.DB) error {
 
 type Food struct {
 	gorm.Model
-	Name          string  `json:"name" binding:"required"`
-	Calories      int     `json:"calories" binding:"required"`
-	Protein       float64 `json:"protein"`
-	Carbohydrates float64 `json:"carbohydrates"`
-	Fat           float64 `json:"fat"`
-	ServingSize   int     `json:"serving_size" binding:"required"` // Base serving size in grams
-	Category      string  `json:"category"`                        // Food category
+	SourceID      *int          `json:"source_id,omitempty" gorm:"index"` // ID of the row in dataset.csv
+	Name          string        `json:"name" binding:"required"`
+	Calories      int           `json:"calories" binding:"required"`
+	Protein       float64       `json:"protein"`
+	Carbohydrates float64       `json:"carbohydrates"`
+	Fat           float64       `json:"fat"`
+	ServingSize   int           `json:"serving_size" binding:"required"` // Base serving size in grams
+	Category      string        `json:"category"`                        // Food category
+	RetiredAt     *time.Time    `json:"retired_at,omitempty"`            // Set when the food was removed from the dataset
+	MergedIntoID  *uint         `json:"merged_into_id,omitempty"`        // Set when the food was merged into a duplicate
+	Tags          []string      `json:"tags" gorm:"serializer:json"`
+	InferredTags  []string      `json:"inferred_tags" gorm:"serializer:json"`
+	Allergens     []string      `json:"allergens" gorm:"serializer:json"`
+	Servings      []FoodServing `json:"servings,omitempty" gorm:"foreignKey:FoodID"`
 }
 
 type FoodServing struct {
@@ -227,21 +281,49 @@ type FoodServing struct {
 
 type FoodEntry struct {
 	gorm.Model
-	UserID       uint    `json:"user_id"`
-	FoodID       uint    `json:"food_id" binding:"required"`
-	Food         Food    `json:"food" gorm:"foreignKey:FoodID;references:ID" binding:"-"`
-	ServingDesc  string  `json:"serving_desc" binding:"required"`
-	ServingGrams float64 `json:"serving_grams"`
-	Quantity     float64 `json:"quantity" binding:"required"`
-	Date         string  `json:"date" binding:"required"`
-	Calories     float64 `json:"calories"`
-	FoodSetID    *uint   `json:"food_set_id,omitempty"`
+	UserID        uint       `json:"user_id"`
+	FoodID        uint       `json:"food_id" binding:"required"`
+	Food          Food       `json:"food" gorm:"foreignKey:FoodID;references:ID" binding:"-"`
+	ServingDesc   string     `json:"serving_desc" binding:"required"`
+	ServingGrams  float64    `json:"serving_grams"`
+	Quantity      float64    `json:"quantity" binding:"required"`
+	Date          string     `json:"date" binding:"required"`
+	Meal          string     `json:"meal"`           // One of the user's meals, empty if unassigned
+	Time          string     `json:"time,omitempty"` // Optional time of day as HH:MM
+	Calories      float64    `json:"calories"`
+	Protein       float64    `json:"protein"`               // Grams of protein in the entry
+	Carbohydrates float64    `json:"carbohydrates"`         // Grams of carbohydrates in the entry
+	Fat           float64    `json:"fat"`                   // Grams of fat in the entry
+	ConsumedAt    *time.Time `json:"consumed_at,omitempty"` // When the entry was eaten, in UTC
+	UndoToken     string     `json:"-" gorm:"index"`        // Set by the delete call that removed the entry
+	RecurringID   *uint      `json:"recurring_id,omitempty" gorm:"index"`
 }
 
 type FoodSet struct {
 	gorm.Model
-	UserID      uint        `json:"user_id"`
-	Name        string      `json:"name" binding:"required"`
-	Description string      `json:"description"`
-	Entries     []FoodEntry `json:"entries" gorm:"foreignKey:FoodSetID"`
+	UserID      uint          `json:"user_id"`
+	Name        string        `json:"name" binding:"required"`
+	Description string        `json:"description"`
+	Entries     []FoodSetItem `json:"entries" gorm:"foreignKey:FoodSetID" binding:"dive"` // Items are deleted with the set
+	Visibility  string        `json:"visibility" gorm:"default:'private'" binding:"-"`    // "private", "link" or "public"
+	ShareToken  *string       `json:"-" gorm:"index" binding:"-"`                         // Lets anyone with the link view the set
+	SourceSetID *uint         `json:"source_set_id,omitempty" binding:"-"`                // Set this one was imported from
+	SourceOwner string        `json:"source_owner,omitempty" binding:"-"`                 // Name of the user who shared it
+	ImportCount int           `json:"import_count" binding:"-"`                           // Times the set was imported by others
+}
+
+// FoodSetItem is a food in a set. Unlike a FoodEntry it has no date and is
+// only logged when the set is applied.
+type FoodSetItem struct {
+	gorm.Model
+	FoodSetID     uint    `json:"food_set_id" gorm:"index"`
+	FoodID        uint    `json:"food_id" binding:"required"`
+	Food          Food    `json:"food" gorm:"foreignKey:FoodID" binding:"-"`
+	ServingDesc   string  `json:"serving_desc" binding:"required"`
+	ServingGrams  float64 `json:"serving_grams"`
+	Quantity      float64 `json:"quantity" binding:"required,gt=0"`
+	Calories      float64 `json:"calories"`
+	Protein       float64 `json:"protein"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Fat           float64 `json:"fat"`
 }